@@ -14,40 +14,287 @@
 package filesystem
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/wealdtech/go-indexer"
 )
 
+// AccountNameConflictError is returned when an account cannot be stored because
+// another account in the same wallet has the same name.
+type AccountNameConflictError struct {
+	WalletID          uuid.UUID
+	Name              string
+	ExistingAccountID uuid.UUID
+}
+
+// Error returns a description of the error.
+func (e *AccountNameConflictError) Error() string {
+	return fmt.Sprintf("account name %q in wallet %s is already used by account %s", e.Name, e.WalletID, e.ExistingAccountID)
+}
+
+// Is allows the error to match ErrAccountNameConflict.
+func (e *AccountNameConflictError) Is(target error) bool {
+	return target == ErrAccountNameConflict
+}
+
 // StoreAccount stores an account.  It will fail if it cannot store the data.
 // Note this will overwrite an existing account with the same ID.  It will not, however, allow multiple accounts with the same
-// name to co-exist in the same wallet.
+// name to co-exist in the same wallet, returning an AccountNameConflictError instead.
+// If the store manages the accounts index, the index is updated along with the account.
 func (s *Store) StoreAccount(walletID uuid.UUID, accountID uuid.UUID, data []byte) error {
+	unlock, err := s.lockWallet(walletID, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
 	// Ensure the wallet exists.
-	_, err := s.RetrieveWalletByID(walletID)
+	_, err = s.retrieveWalletByID(walletID)
 	if err != nil {
 		return errors.Wrap(err, "unable to retrieve wallet")
 	}
 
-	data, err = s.encryptIfRequired(data)
+	name := nameOf(data)
+	if name != "" {
+		if err := s.checkAccountName(walletID, accountID, name); err != nil {
+			return err
+		}
+	}
+
+	data, err = s.encryptIfRequired(accountBinding(walletID, accountID), data)
 	if err != nil {
 		return errors.Wrap(err, "failed to encrypt account")
 	}
 	path := s.accountPath(walletID, accountID)
 
-	return os.WriteFile(filepath.FromSlash(path), data, 0o600)
+	return s.trackAccountNames(walletID, accountID, name, func() error {
+		if s.manageAccountsIndex {
+			return s.storeAccountWithIndex(walletID, accountID, name, data)
+		}
+
+		return writeFile(filepath.FromSlash(path), data, 0o600)
+	})
+}
+
+// storeAccountWithIndex stores encrypted account data along with the updated
+// accounts index, committing both together.
+// The caller must hold an exclusive lock on the wallet.
+func (s *Store) storeAccountWithIndex(walletID uuid.UUID, accountID uuid.UUID, name string, data []byte) error {
+	index, err := s.accountsIndexForUpdate(walletID)
+	if err != nil {
+		return errors.Wrap(err, "failed to obtain accounts index")
+	}
+	removeIndexEntry(index, accountID)
+	if name != "" {
+		index.Add(accountID, name)
+	}
+	indexData, err := s.encodeAccountsIndex(walletID, index)
+	if err != nil {
+		return err
+	}
+
+	return s.commitWalletChanges(walletID, []*walletChange{
+		{path: s.accountPath(walletID, accountID), data: data},
+		{path: s.walletIndexPath(walletID), data: indexData},
+	})
+}
+
+// checkAccountName checks that no account in the wallet other than the given
+// account has the given name.  If the store manages the accounts index the
+// index is current, so it is used to find the account with the name.
+// Otherwise the names of the wallet's accounts are read, with names cached
+// between calls so that only accounts that have changed are read again.
+// Accounts that cannot be read are skipped.
+// The caller must hold a lock on the wallet.
+func (s *Store) checkAccountName(walletID uuid.UUID, accountID uuid.UUID, name string) error {
+	if s.manageAccountsIndex {
+		if index, err := s.managedAccountsIndex(walletID); err == nil {
+			existingID, exists := index.ID(name)
+			if !exists || existingID == accountID {
+				return nil
+			}
+			if _, err := os.Stat(s.accountPath(walletID, existingID)); err != nil {
+				// Account removed without the index being updated.
+				return nil
+			}
+			return &AccountNameConflictError{WalletID: walletID, Name: name, ExistingAccountID: existingID}
+		}
+	}
+
+	names, err := s.accountNames(walletID)
+	if err != nil {
+		return errors.Wrap(err, "failed to check account names")
+	}
+	for existingID, existing := range names {
+		if existingID != accountID && existing.name == name {
+			return &AccountNameConflictError{WalletID: walletID, Name: name, ExistingAccountID: existingID}
+		}
+	}
+
+	return nil
+}
+
+// managedAccountsIndex returns the accounts index for the wallet, if it exists
+// and can be read.
+// The caller must hold a lock on the wallet.
+func (s *Store) managedAccountsIndex(walletID uuid.UUID) (*indexer.Index, error) {
+	data, err := s.retrieveAccountsIndex(walletID)
+	if err != nil {
+		return nil, err
+	}
+	index, err := indexer.Deserialize(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse accounts index")
+	}
+
+	return index, nil
+}
+
+// accountName is the name of an account, along with the modification time
+// and size of the file from which it was read.
+type accountName struct {
+	modTime time.Time
+	size    int64
+	name    string
+}
+
+// walletAccountNames are the names of the accounts in a wallet, along with
+// the modification time of the wallet's directory when they were read.
+type walletAccountNames struct {
+	modTime time.Time
+	names   map[uuid.UUID]*accountName
+}
+
+// accountNames returns the names of the accounts in the wallet that can be read.
+// Names are cached, and are read again only if the wallet's directory has
+// changed other than by this store, in which case only accounts whose files
+// have changed are read.  Files are always replaced rather than modified in
+// place, so any change to an account changes the wallet's directory.
+// The caller must hold a lock on the wallet.
+func (s *Store) accountNames(walletID uuid.UUID) (map[uuid.UUID]*accountName, error) {
+	info, err := os.Stat(s.walletPath(walletID))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read wallet")
+	}
+	s.accountNamesMutex.Lock()
+	cached := s.accountNamesCache[walletID]
+	s.accountNamesMutex.Unlock()
+	if cached != nil && cached.modTime.Equal(info.ModTime()) {
+		return cached.names, nil
+	}
+
+	entries, err := os.ReadDir(s.walletPath(walletID))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read wallet")
+	}
+	names := make(map[uuid.UUID]*accountName, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || isInternalFile(entry.Name()) {
+			continue
+		}
+		accountID, err := uuid.Parse(entry.Name())
+		if err != nil || accountID == walletID {
+			continue
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			// Account removed since the wallet was read.
+			continue
+		}
+		if cached != nil {
+			if existing, exists := cached.names[accountID]; exists && existing.modTime.Equal(fileInfo.ModTime()) && existing.size == fileInfo.Size() {
+				names[accountID] = existing
+				continue
+			}
+		}
+		res := s.retrieveAccountResult(walletID, accountID, false)
+		if res == nil || res.Err != nil {
+			// Account removed, or cannot be read.
+			continue
+		}
+		names[accountID] = &accountName{
+			modTime: fileInfo.ModTime(),
+			size:    fileInfo.Size(),
+			name:    nameOf(res.Data),
+		}
+	}
+
+	s.accountNamesMutex.Lock()
+	if s.accountNamesCache == nil {
+		s.accountNamesCache = make(map[uuid.UUID]*walletAccountNames)
+	}
+	// The time is that from before the directory was read, so that changes
+	// made while it was being read cause it to be read again.
+	s.accountNamesCache[walletID] = &walletAccountNames{modTime: info.ModTime(), names: names}
+	s.accountNamesMutex.Unlock()
+
+	return names, nil
+}
+
+// trackAccountNames makes a write to the wallet, keeping the cached names of
+// the wallet's accounts current if they were current before the write, so
+// that they are not read again as a result of it.  If the write stores an
+// account, its ID and name are supplied.
+// The caller must hold an exclusive lock on the wallet.
+func (s *Store) trackAccountNames(walletID uuid.UUID, accountID uuid.UUID, name string, write func() error) error {
+	before, err := os.Stat(s.walletPath(walletID))
+	if err != nil {
+		return errors.Wrap(err, "failed to read wallet")
+	}
+	if err := write(); err != nil {
+		return err
+	}
+
+	s.accountNamesMutex.Lock()
+	defer s.accountNamesMutex.Unlock()
+	cached := s.accountNamesCache[walletID]
+	if cached == nil || !cached.modTime.Equal(before.ModTime()) {
+		return nil
+	}
+	after, err := os.Stat(s.walletPath(walletID))
+	if err != nil {
+		delete(s.accountNamesCache, walletID)
+		return nil
+	}
+	if accountID != uuid.Nil {
+		fileInfo, err := os.Stat(s.accountPath(walletID, accountID))
+		if err != nil {
+			delete(s.accountNamesCache, walletID)
+			return nil
+		}
+		cached.names[accountID] = &accountName{
+			modTime: fileInfo.ModTime(),
+			size:    fileInfo.Size(),
+			name:    name,
+		}
+	}
+	cached.modTime = after.ModTime()
+
+	return nil
 }
 
 // RetrieveAccount retrieves account-level data.  It will return an error if it cannot retrieve the data.
 func (s *Store) RetrieveAccount(walletID uuid.UUID, accountID uuid.UUID) ([]byte, error) {
+	unlock, err := s.lockWallet(walletID, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
 	path := s.accountPath(walletID, accountID)
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, errors.Wrap(err, "account not found")
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %w", ErrAccountNotFound, err)
+		}
+		return nil, errors.Wrap(err, "failed to read account")
 	}
-	data, err = s.decryptIfRequired(data)
+	data, err = s.decryptIfRequired(accountBinding(walletID, accountID), data)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to decrypt account")
 	}
@@ -56,38 +303,78 @@ func (s *Store) RetrieveAccount(walletID uuid.UUID, accountID uuid.UUID) ([]byte
 }
 
 // RetrieveAccounts retrieves all account-level data for a wallet.
+// Accounts that cannot be retrieved are skipped; use RetrieveAccountResults to find out
+// about them.  The caller must read the channel until it is closed; use
+// RetrieveAccountsContext to be able to stop early.
 func (s *Store) RetrieveAccounts(walletID uuid.UUID) <-chan []byte {
 	ch := make(chan []byte, 1024)
 	go func() {
 		defer close(ch)
-		files, err := os.ReadDir(s.walletPath(walletID))
-		if err != nil {
-			return
-		}
-
-		walletName := walletID.String()
-		for _, file := range files {
-			switch file.Name() {
-			case walletName, "index", "batch":
-				// Not accounts.
-				continue
-			default:
-				accountID, err := uuid.Parse(file.Name())
-				if err != nil {
-					continue
-				}
-				data, err := os.ReadFile(s.accountPath(walletID, accountID))
-				if err != nil {
-					continue
-				}
-				data, err = s.decryptIfRequired(data)
-				if err != nil {
-					continue
-				}
-				ch <- data
+		s.walkAccounts(context.Background(), walletID, true, func(res *RetrieveResult) bool {
+			if res.Err == nil {
+				ch <- res.Data
 			}
-		}
+			return true
+		})
 	}()
 
 	return ch
 }
+
+// DeleteAccount deletes an account.  It will return ErrAccountNotFound if the account does not exist.
+// The account is removed from the accounts index, if present, and the wallet's batch is invalidated.
+func (s *Store) DeleteAccount(walletID uuid.UUID, accountID uuid.UUID) error {
+	unlock, err := s.lockWallet(walletID, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
+	path := s.accountPath(walletID, accountID)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return errors.Wrap(ErrAccountNotFound, accountID.String())
+		}
+		return errors.Wrap(err, "failed to obtain account information")
+	}
+
+	if s.manageAccountsIndex {
+		if err := s.deleteAccountWithIndex(walletID, accountID); err != nil {
+			return err
+		}
+	} else {
+		if err := removeFile(path); err != nil {
+			return errors.Wrap(err, "failed to remove account")
+		}
+
+		if err := s.removeFromAccountsIndex(walletID, accountID); err != nil {
+			return errors.Wrap(err, "failed to update accounts index")
+		}
+	}
+
+	if err := s.invalidateBatch(walletID); err != nil {
+		return errors.Wrap(err, "failed to invalidate batch")
+	}
+
+	return nil
+}
+
+// deleteAccountWithIndex removes an account along with its entry in the
+// accounts index, committing both together.
+// The caller must hold an exclusive lock on the wallet.
+func (s *Store) deleteAccountWithIndex(walletID uuid.UUID, accountID uuid.UUID) error {
+	index, err := s.accountsIndexForUpdate(walletID)
+	if err != nil {
+		return errors.Wrap(err, "failed to obtain accounts index")
+	}
+	removeIndexEntry(index, accountID)
+	indexData, err := s.encodeAccountsIndex(walletID, index)
+	if err != nil {
+		return err
+	}
+
+	return s.commitWalletChanges(walletID, []*walletChange{
+		{path: s.accountPath(walletID, accountID)},
+		{path: s.walletIndexPath(walletID), data: indexData},
+	})
+}
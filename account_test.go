@@ -14,6 +14,8 @@
 package filesystem_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -24,6 +26,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+	"github.com/wealdtech/go-indexer"
 )
 
 func TestStoreRetrieveAccount(t *testing.T) {
@@ -68,6 +71,71 @@ func TestDuplicateAccounts(t *testing.T) {
 	require.Nil(t, err)
 	err = store.StoreAccount(walletID, accountID, accountData)
 	require.Nil(t, err)
+
+	// Overwriting the same account is allowed.
+	err = store.StoreAccount(walletID, accountID, accountData)
+	require.Nil(t, err)
+
+	// Another account with the same name is not, whether or not it is in the index.
+	otherAccountID := uuid.New()
+	otherAccountData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, accountName, otherAccountID.String()))
+	err = store.StoreAccount(walletID, otherAccountID, otherAccountData)
+	require.True(t, errors.Is(err, filesystem.ErrAccountNameConflict))
+	var conflictErr *filesystem.AccountNameConflictError
+	require.True(t, errors.As(err, &conflictErr))
+	require.Equal(t, accountID, conflictErr.ExistingAccountID)
+
+	index := indexer.New()
+	index.Add(accountID, accountName)
+	indexData, err := index.Serialize()
+	require.NoError(t, err)
+	require.NoError(t, store.StoreAccountsIndex(walletID, indexData))
+	err = store.StoreAccount(walletID, otherAccountID, otherAccountData)
+	require.True(t, errors.Is(err, filesystem.ErrAccountNameConflict))
+
+	// Once the account is renamed its name is free, even though the index is out of date.
+	renamedAccountData := []byte(fmt.Sprintf(`{"name":"renamed account","uuid":%q}`, accountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, accountID, renamedAccountData))
+	require.NoError(t, store.StoreAccount(walletID, otherAccountID, otherAccountData))
+	err = store.StoreAccount(walletID, accountID, accountData)
+	require.True(t, errors.Is(err, filesystem.ErrAccountNameConflict))
+
+	// The index still holds the original name of the renamed account, but its
+	// current name is checked.
+	thirdAccountID := uuid.New()
+	err = store.StoreAccount(walletID, thirdAccountID, []byte(fmt.Sprintf(`{"name":"renamed account","uuid":%q}`, thirdAccountID.String())))
+	require.True(t, errors.Is(err, filesystem.ErrAccountNameConflict))
+	require.True(t, errors.As(err, &conflictErr))
+	require.Equal(t, accountID, conflictErr.ExistingAccountID)
+
+	// An account that cannot be read does not stop others from being stored.
+	otherAccountPath := filepath.Join(path, walletID.String(), otherAccountID.String())
+	onDisk, err := os.ReadFile(otherAccountPath)
+	require.NoError(t, err)
+	onDisk[len(onDisk)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(otherAccountPath, onDisk, 0o600))
+	require.NoError(t, store.StoreAccount(walletID, thirdAccountID, []byte(fmt.Sprintf(`{"name":"third account","uuid":%q}`, thirdAccountID.String()))))
+}
+
+func TestAccountNamesChangedElsewhere(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path))
+	otherStore := filesystem.New(filesystem.WithLocation(path))
+
+	walletID := uuid.New()
+	require.NoError(t, store.StoreWallet(walletID, "test wallet", []byte(fmt.Sprintf(`{"name":"test wallet","uuid":%q}`, walletID.String()))))
+	accountID := uuid.New()
+	require.NoError(t, store.StoreAccount(walletID, accountID, []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))))
+	otherAccountID := uuid.New()
+	require.NoError(t, store.StoreAccount(walletID, otherAccountID, []byte(fmt.Sprintf(`{"name":"other account","uuid":%q}`, otherAccountID.String()))))
+
+	// Names changed by another store are seen.
+	require.NoError(t, otherStore.StoreAccount(walletID, accountID, []byte(fmt.Sprintf(`{"name":"renamed account","uuid":%q}`, accountID.String()))))
+	thirdAccountID := uuid.New()
+	err := store.StoreAccount(walletID, thirdAccountID, []byte(fmt.Sprintf(`{"name":"renamed account","uuid":%q}`, thirdAccountID.String())))
+	require.True(t, errors.Is(err, filesystem.ErrAccountNameConflict))
+	require.NoError(t, store.StoreAccount(walletID, thirdAccountID, []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, thirdAccountID.String()))))
 }
 
 func TestRetrieveNonExistentAccount(t *testing.T) {
@@ -80,6 +148,7 @@ func TestRetrieveNonExistentAccount(t *testing.T) {
 
 	_, err := store.RetrieveAccount(walletID, accountID)
 	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, filesystem.ErrAccountNotFound))
 }
 
 func TestStoreNonExistentAccount(t *testing.T) {
@@ -94,3 +163,51 @@ func TestStoreNonExistentAccount(t *testing.T) {
 	err := store.StoreAccount(walletID, accountID, data)
 	assert.NotNil(t, err)
 }
+
+func TestDeleteAccount(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	accountID := uuid.New()
+	accountName := "test account"
+	accountData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, accountName, accountID.String()))
+
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+	index := indexer.New()
+	index.Add(accountID, accountName)
+	// A caller-supplied index can hold another entry with the same name.
+	otherAccountID := uuid.New()
+	index.Add(otherAccountID, accountName)
+	serializedIndex, err := index.Serialize()
+	require.NoError(t, err)
+	require.NoError(t, store.StoreAccountsIndex(walletID, serializedIndex))
+	require.NoError(t, store.StoreBatch(ctx, walletID, walletName, []byte(`{"test":true}`)))
+
+	require.NoError(t, store.DeleteAccount(walletID, accountID))
+
+	_, err = store.RetrieveAccount(walletID, accountID)
+	require.Error(t, err)
+	for range store.RetrieveAccounts(walletID) {
+		require.Fail(t, "account returned after deletion")
+	}
+	serializedIndex, err = store.RetrieveAccountsIndex(walletID)
+	require.NoError(t, err)
+	index, err = indexer.Deserialize(serializedIndex)
+	require.NoError(t, err)
+	require.False(t, index.IDKnown(accountID))
+	id, exists := index.ID(accountName)
+	require.True(t, exists)
+	require.Equal(t, otherAccountID, id)
+	_, err = store.RetrieveBatch(ctx, walletID)
+	require.Error(t, err)
+
+	err = store.DeleteAccount(walletID, accountID)
+	require.True(t, errors.Is(err, filesystem.ErrAccountNotFound))
+}
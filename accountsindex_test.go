@@ -0,0 +1,145 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+	"github.com/wealdtech/go-indexer"
+)
+
+// retrieveIndex retrieves and parses the accounts index for a wallet.
+func retrieveIndex(t *testing.T, store *filesystem.Store, walletID uuid.UUID) *indexer.Index {
+	t.Helper()
+
+	data, err := store.RetrieveAccountsIndex(walletID)
+	require.NoError(t, err)
+	index, err := indexer.Deserialize(data)
+	require.NoError(t, err)
+
+	return index
+}
+
+func TestManagedAccountsIndex(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+
+	walletID := uuid.New()
+	walletData := []byte(fmt.Sprintf(`{"name":"test wallet","uuid":%q}`, walletID))
+	existingAccountID := uuid.New()
+
+	// An account stored without the index being managed.
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase)).(*filesystem.Store)
+	require.NoError(t, store.StoreWallet(walletID, "test wallet", walletData))
+	require.NoError(t, store.StoreAccount(walletID, existingAccountID, []byte(fmt.Sprintf(`{"name":"existing account","uuid":%q}`, existingAccountID))))
+	_, err := store.RetrieveAccountsIndex(walletID)
+	require.True(t, errors.Is(err, filesystem.ErrIndexNotFound))
+
+	// Once managed, the index is built from the existing accounts and kept up to date.
+	store = filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase), filesystem.WithManagedAccountsIndex(true)).(*filesystem.Store)
+	accountID := uuid.New()
+	require.NoError(t, store.StoreAccount(walletID, accountID, []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID))))
+	index := retrieveIndex(t, store, walletID)
+	name, exists := index.Name(existingAccountID)
+	require.True(t, exists)
+	require.Equal(t, "existing account", name)
+	name, exists = index.Name(accountID)
+	require.True(t, exists)
+	require.Equal(t, "test account", name)
+
+	// Renamed account.
+	require.NoError(t, store.StoreAccount(walletID, accountID, []byte(fmt.Sprintf(`{"name":"renamed account","uuid":%q}`, accountID))))
+	index = retrieveIndex(t, store, walletID)
+	require.False(t, index.NameKnown("test account"))
+	id, exists := index.ID("renamed account")
+	require.True(t, exists)
+	require.Equal(t, accountID, id)
+
+	// Deleted account.
+	require.NoError(t, store.DeleteAccount(walletID, existingAccountID))
+	index = retrieveIndex(t, store, walletID)
+	require.False(t, index.IDKnown(existingAccountID))
+	require.True(t, index.IDKnown(accountID))
+	_, err = store.RetrieveAccount(walletID, existingAccountID)
+	require.True(t, errors.Is(err, filesystem.ErrAccountNotFound))
+
+	// No staging files are left behind.
+	entries, err := os.ReadDir(filepath.Join(path, walletID.String()))
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NotContains(t, entry.Name(), "journal")
+	}
+}
+
+func TestManagedAccountsIndexNames(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("test")), filesystem.WithManagedAccountsIndex(true)).(*filesystem.Store)
+	walletID := uuid.New()
+	require.NoError(t, store.StoreWallet(walletID, "test wallet", []byte(fmt.Sprintf(`{"name":"test wallet","uuid":%q}`, walletID))))
+	accountID := uuid.New()
+	require.NoError(t, store.StoreAccount(walletID, accountID, []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID))))
+
+	// Names are checked against the index.
+	otherAccountID := uuid.New()
+	err := store.StoreAccount(walletID, otherAccountID, []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, otherAccountID)))
+	var conflictErr *filesystem.AccountNameConflictError
+	require.True(t, errors.As(err, &conflictErr))
+	require.Equal(t, accountID, conflictErr.ExistingAccountID)
+
+	// An account that cannot be read does not stop others from being stored,
+	// and its name remains taken.
+	accountPath := filepath.Join(path, walletID.String(), accountID.String())
+	require.NoError(t, os.WriteFile(accountPath, []byte("unreadable"), 0o600))
+	require.NoError(t, store.StoreAccount(walletID, otherAccountID, []byte(fmt.Sprintf(`{"name":"other account","uuid":%q}`, otherAccountID))))
+	thirdAccountID := uuid.New()
+	err = store.StoreAccount(walletID, thirdAccountID, []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, thirdAccountID)))
+	require.True(t, errors.Is(err, filesystem.ErrAccountNameConflict))
+}
+
+func TestManagedAccountsIndexUnreadable(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+
+	walletID := uuid.New()
+	walletData := []byte(fmt.Sprintf(`{"name":"test wallet","uuid":%q}`, walletID))
+	existingAccountID := uuid.New()
+	unreadableAccountID := uuid.New()
+
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase)).(*filesystem.Store)
+	require.NoError(t, store.StoreWallet(walletID, "test wallet", walletData))
+	require.NoError(t, store.StoreAccount(walletID, existingAccountID, []byte(fmt.Sprintf(`{"name":"existing account","uuid":%q}`, existingAccountID))))
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), unreadableAccountID.String()), []byte("bad"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), "notes.txt~"), []byte("notes"), 0o600))
+
+	// Building the index for the first update skips the unreadable account and the file that is not an account.
+	store = filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase), filesystem.WithManagedAccountsIndex(true)).(*filesystem.Store)
+	accountID := uuid.New()
+	require.NoError(t, store.StoreAccount(walletID, accountID, []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID))))
+	index := retrieveIndex(t, store, walletID)
+	require.True(t, index.IDKnown(existingAccountID))
+	require.True(t, index.IDKnown(accountID))
+	require.False(t, index.IDKnown(unreadableAccountID))
+}
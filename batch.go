@@ -15,6 +15,7 @@ package filesystem
 
 import (
 	"context"
+	"fmt"
 	"os"
 
 	"github.com/google/uuid"
@@ -23,26 +24,38 @@ import (
 
 // StoreBatch stores wallet batch data.  It will fail if it cannot store the data.
 func (s *Store) StoreBatch(_ context.Context, walletID uuid.UUID, _ string, data []byte) error {
+	unlock, err := s.lockWallet(walletID, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
 	// Ensure wallet exists.
-	_, err := s.RetrieveWalletByID(walletID)
+	_, err = s.retrieveWalletByID(walletID)
 	if err != nil {
 		return err
 	}
 
-	data, err = s.encryptIfRequired(data)
+	data, err = s.encryptIfRequired(batchBinding(walletID), data)
 	if err != nil {
 		return errors.Wrap(err, "failed to encrypt batch")
 	}
 
 	path := s.walletBatchPath(walletID)
 
-	return os.WriteFile(path, data, 0o600)
+	return writeFile(path, data, 0o600)
 }
 
 // RetrieveBatch retrieves the batch of accounts for a given wallet.
 func (s *Store) RetrieveBatch(_ context.Context, walletID uuid.UUID) ([]byte, error) {
+	unlock, err := s.lockWallet(walletID, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
 	// Ensure wallet exists.
-	_, err := s.RetrieveWalletByID(walletID)
+	_, err = s.retrieveWalletByID(walletID)
 	if err != nil {
 		return nil, err
 	}
@@ -50,8 +63,52 @@ func (s *Store) RetrieveBatch(_ context.Context, walletID uuid.UUID) ([]byte, er
 	path := s.walletBatchPath(walletID)
 	data, err := os.ReadFile(path)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %w", ErrBatchNotFound, err)
+		}
 		return nil, errors.Wrap(err, "failed to read batch")
 	}
 
-	return s.decryptIfRequired(data)
+	data, err = s.decryptIfRequired(batchBinding(walletID), data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt batch")
+	}
+
+	return data, nil
+}
+
+// InvalidateBatch marks the batch for a given wallet as stale, for example
+// after its accounts have been changed or recovered, by removing it.  Higher-level
+// functions fall back to individual accounts until the batch is regenerated.
+func (s *Store) InvalidateBatch(_ context.Context, walletID uuid.UUID) error {
+	unlock, err := s.lockWallet(walletID, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
+	// Ensure wallet exists.
+	_, err = s.retrieveWalletByID(walletID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.invalidateBatch(walletID); err != nil {
+		return errors.Wrap(err, "failed to invalidate batch")
+	}
+
+	return nil
+}
+
+// invalidateBatch invalidates the batch for a given wallet, as it no longer
+// reflects the accounts held in the wallet.  Higher-level functions will
+// fall back to individual accounts until the batch is regenerated.
+// The caller must hold an exclusive lock on the wallet.
+func (s *Store) invalidateBatch(walletID uuid.UUID) error {
+	err := removeFile(s.walletBatchPath(walletID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
 }
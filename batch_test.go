@@ -15,6 +15,7 @@ package filesystem_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -72,6 +73,7 @@ func TestRetrieveBatchNonExistentWallet(t *testing.T) {
 
 	_, err := store.(e2wtypes.BatchRetriever).RetrieveBatch(ctx, walletID)
 	require.ErrorContains(t, err, "wallet not found")
+	require.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
 }
 
 func TestRetrieveNonExistentBatch(t *testing.T) {
@@ -88,4 +90,28 @@ func TestRetrieveNonExistentBatch(t *testing.T) {
 
 	_, err := store.(e2wtypes.BatchRetriever).RetrieveBatch(ctx, walletID)
 	require.ErrorContains(t, err, "no such file or directory")
+	require.True(t, errors.Is(err, filesystem.ErrBatchNotFound))
+	require.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestInvalidateBatch(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	data := []byte(fmt.Sprintf(`{"uuid":%q,"name":%q}`, walletID, walletName))
+	require.NoError(t, store.StoreWallet(walletID, walletName, data))
+	require.NoError(t, store.StoreBatch(ctx, walletID, walletName, []byte(`{"test":true}`)))
+
+	require.NoError(t, store.InvalidateBatch(ctx, walletID))
+	_, err := store.RetrieveBatch(ctx, walletID)
+	require.True(t, errors.Is(err, filesystem.ErrBatchNotFound))
+
+	// Invalidating a wallet without a batch is not an error.
+	require.NoError(t, store.InvalidateBatch(ctx, walletID))
+	require.True(t, errors.Is(store.InvalidateBatch(ctx, uuid.New()), filesystem.ErrWalletNotFound))
 }
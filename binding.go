@@ -0,0 +1,172 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/hkdf"
+)
+
+// aeadKeyInfo is the HKDF info used to derive the AES-256-GCM key from the
+// key derived from the passphrase.
+const aeadKeyInfo = "go-eth2-wallet-store-filesystem aes-256-gcm"
+
+// fileRole is the role of a file in the store.
+type fileRole byte
+
+// Roles of files in the store.
+const (
+	roleWallet      fileRole = 1
+	roleAccount     fileRole = 2
+	roleIndex       fileRole = 3
+	roleBatch       fileRole = 4
+	roleWalletNames fileRole = 5
+)
+
+// fileBinding is the location of data in the store.  Encrypted data is bound
+// to its location, so that it cannot be moved elsewhere in the store.
+type fileBinding struct {
+	role      fileRole
+	walletID  uuid.UUID
+	accountID uuid.UUID
+}
+
+func walletBinding(walletID uuid.UUID) *fileBinding {
+	return &fileBinding{role: roleWallet, walletID: walletID}
+}
+
+func accountBinding(walletID uuid.UUID, accountID uuid.UUID) *fileBinding {
+	return &fileBinding{role: roleAccount, walletID: walletID, accountID: accountID}
+}
+
+func indexBinding(walletID uuid.UUID) *fileBinding {
+	return &fileBinding{role: roleIndex, walletID: walletID}
+}
+
+func batchBinding(walletID uuid.UUID) *fileBinding {
+	return &fileBinding{role: roleBatch, walletID: walletID}
+}
+
+func walletNamesBinding() *fileBinding {
+	return &fileBinding{role: roleWalletNames}
+}
+
+// bindingForPath returns the binding for a data file at the given path
+// within a wallet directory.
+func bindingForPath(walletID uuid.UUID, path string) (*fileBinding, error) {
+	switch name := filepath.Base(path); name {
+	case walletID.String():
+		return walletBinding(walletID), nil
+	case "index":
+		return indexBinding(walletID), nil
+	case "batch":
+		return batchBinding(walletID), nil
+	default:
+		accountID, err := uuid.Parse(name)
+		if err != nil {
+			return nil, err
+		}
+		return accountBinding(walletID, accountID), nil
+	}
+}
+
+// associatedData returns the data that authenticated encryption binds to
+// the encrypted data: the envelope's header followed by the binding.
+func (b *fileBinding) associatedData(header []byte) []byte {
+	res := make([]byte, 0, len(header)+1+2*len(uuid.UUID{}))
+	res = append(res, header...)
+	res = append(res, byte(b.role))
+	res = append(res, b.walletID[:]...)
+	res = append(res, b.accountID[:]...)
+
+	return res
+}
+
+// aeadEncrypt encrypts data with AES-256-GCM, returning the parameters of the
+// key derivation function, salt, nonce and sealed data.  The envelope's
+// identifier for the key derivation function is keys.kdf.envelopeKDF().
+func aeadEncrypt(keys *keyCache, data []byte, associatedData []byte) ([]byte, error) {
+	salt, key, err := keys.encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	defer zero(key)
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	params := keys.kdf.encode()
+	res := make([]byte, len(params)+ecodecSaltLen+aead.NonceSize(), len(params)+ecodecSaltLen+aead.NonceSize()+len(data)+aead.Overhead())
+	copy(res, params)
+	copy(res[len(params):], salt)
+	nonce := res[len(params)+ecodecSaltLen:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(res, nonce, data, associatedData), nil
+}
+
+// aeadDecrypt decrypts data encrypted by aeadEncrypt, with the envelope's
+// identifier for the key derivation function.
+func aeadDecrypt(keys *keyCache, kdf byte, data []byte, associatedData []byte) ([]byte, error) {
+	params, data, err := decodeKDFParams(kdf, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < ecodecSaltLen {
+		return nil, errors.New("encrypted data too short")
+	}
+	key, err := keys.key(params, data[:ecodecSaltLen])
+	if err != nil {
+		return nil, err
+	}
+	defer zero(key)
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < ecodecSaltLen+aead.NonceSize() {
+		return nil, errors.New("encrypted data too short")
+	}
+	nonce := data[ecodecSaltLen : ecodecSaltLen+aead.NonceSize()]
+
+	ciphertext := data[ecodecSaltLen+aead.NonceSize():]
+
+	return aead.Open(make([]byte, 0, len(ciphertext)), nonce, ciphertext, associatedData)
+}
+
+// newAEAD creates an AES-256-GCM cipher with a key derived from the given key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	aeadKey := make([]byte, 32)
+	defer zero(aeadKey)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte(aeadKeyInfo)), aeadKey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(aeadKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
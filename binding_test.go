@@ -0,0 +1,139 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	ecodec "github.com/wealdtech/go-ecodec"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+// copyFile copies a file in the store over another.
+func copyFile(t *testing.T, from string, to string) {
+	t.Helper()
+
+	data, err := os.ReadFile(from)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(to, data, 0o600))
+}
+
+func TestMovedFiles(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("test"))).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+	otherAccountID := uuid.New()
+	otherAccountData := []byte(fmt.Sprintf(`{"name":"other account","uuid":%q}`, otherAccountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, otherAccountID, otherAccountData))
+	require.NoError(t, store.StoreAccountsIndex(walletID, []byte("[]")))
+	require.NoError(t, store.StoreBatch(ctx, walletID, walletName, []byte(`{"test":true}`)))
+	otherWalletID := uuid.New()
+	otherWalletData := []byte(fmt.Sprintf(`{"name":"other wallet","uuid":%q}`, otherWalletID.String()))
+	require.NoError(t, store.StoreWallet(otherWalletID, "other wallet", otherWalletData))
+
+	walletPath := filepath.Join(path, walletID.String())
+	otherWalletPath := filepath.Join(path, otherWalletID.String())
+
+	// Account swapped for another account.
+	copyFile(t, filepath.Join(walletPath, accountID.String()), filepath.Join(walletPath, otherAccountID.String()))
+	_, err := store.RetrieveAccount(walletID, otherAccountID)
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+
+	// Account moved to another wallet.
+	copyFile(t, filepath.Join(walletPath, accountID.String()), filepath.Join(otherWalletPath, accountID.String()))
+	_, err = store.RetrieveAccount(otherWalletID, accountID)
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+
+	// Wallet header presented as an account.
+	copyFile(t, filepath.Join(walletPath, walletID.String()), filepath.Join(walletPath, otherAccountID.String()))
+	_, err = store.RetrieveAccount(walletID, otherAccountID)
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+
+	// Index presented as a batch.
+	copyFile(t, filepath.Join(walletPath, "index"), filepath.Join(walletPath, "batch"))
+	_, err = store.RetrieveBatch(ctx, walletID)
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+
+	// Wallet header moved to another wallet.
+	copyFile(t, filepath.Join(walletPath, walletID.String()), filepath.Join(otherWalletPath, otherWalletID.String()))
+	_, err = store.RetrieveWalletByID(otherWalletID)
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+
+	// Files in their original locations are still readable.
+	data, err := store.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, data)
+	data, err = store.RetrieveWalletByID(walletID)
+	require.NoError(t, err)
+	require.Equal(t, walletData, data)
+}
+
+func TestMovedLegacyFiles(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+
+	// Accounts written by an older version of the store, which did not bind
+	// data to its location or write metadata.
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	legacyAccountData, err := ecodec.Encrypt(accountData, passphrase)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), accountID.String()), legacyAccountData, 0o600))
+	otherAccountID := uuid.New()
+	otherAccountData := []byte(fmt.Sprintf(`{"name":"other account","uuid":%q}`, otherAccountID.String()))
+	legacyOtherAccountData, err := ecodec.Encrypt(otherAccountData, passphrase)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), otherAccountID.String()), legacyOtherAccountData, 0o600))
+	require.NoError(t, os.Remove(filepath.Join(path, "store.json")))
+
+	// Opening the store upgrades it, binding the accounts to their locations.
+	upgraded, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+	require.NoError(t, err)
+	onDisk, err := os.ReadFile(filepath.Join(path, walletID.String(), accountID.String()))
+	require.NoError(t, err)
+	require.NotEqual(t, legacyAccountData, onDisk)
+	data, err := upgraded.RetrieveAccount(walletID, otherAccountID)
+	require.NoError(t, err)
+	require.Equal(t, otherAccountData, data)
+
+	// An account from before the upgrade cannot take the place of another.
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), otherAccountID.String()), legacyAccountData, 0o600))
+	_, err = upgraded.RetrieveAccount(walletID, otherAccountID)
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+}
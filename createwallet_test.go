@@ -0,0 +1,118 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+func TestCreateWallet(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("test"))).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletData := []byte(fmt.Sprintf(`{"name":"validators","uuid":%q}`, walletID))
+	require.NoError(t, store.CreateWallet(walletID, "validators", walletData))
+	data, err := store.RetrieveWallet("validators")
+	require.NoError(t, err)
+	require.Equal(t, walletData, data)
+
+	// The same wallet cannot be created again.
+	err = store.CreateWallet(walletID, "validators", walletData)
+	require.True(t, errors.Is(err, filesystem.ErrWalletExists))
+
+	// Nor can another wallet with the same name.
+	otherWalletID := uuid.New()
+	err = store.CreateWallet(otherWalletID, "validators", []byte(fmt.Sprintf(`{"name":"validators","uuid":%q}`, otherWalletID)))
+	require.True(t, errors.Is(err, filesystem.ErrWalletNameConflict))
+	var conflictErr *filesystem.WalletNameConflictError
+	require.True(t, errors.As(err, &conflictErr))
+	require.Equal(t, walletID, conflictErr.ExistingWalletID)
+	_, err = store.RetrieveWalletByID(otherWalletID)
+	require.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
+
+	// Including one that is missing from the index.
+	require.NoError(t, os.Remove(filepath.Join(path, "wallets.json")))
+	err = store.CreateWallet(otherWalletID, "validators", []byte(fmt.Sprintf(`{"name":"validators","uuid":%q}`, otherWalletID)))
+	require.True(t, errors.Is(err, filesystem.ErrWalletNameConflict))
+
+	// Or one for which the index is out of date.
+	renamedWalletID := uuid.New()
+	require.NoError(t, store.CreateWallet(renamedWalletID, "old name", []byte(fmt.Sprintf(`{"name":"old name","uuid":%q}`, renamedWalletID))))
+	staleNames, err := os.ReadFile(filepath.Join(path, "wallets.json"))
+	require.NoError(t, err)
+	require.NoError(t, store.StoreWallet(renamedWalletID, "new name", []byte(fmt.Sprintf(`{"name":"new name","uuid":%q}`, renamedWalletID))))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "wallets.json"), staleNames, 0o600))
+	err = store.CreateWallet(otherWalletID, "new name", []byte(fmt.Sprintf(`{"name":"new name","uuid":%q}`, otherWalletID)))
+	require.True(t, errors.Is(err, filesystem.ErrWalletNameConflict))
+
+	// A wallet that cannot be read means that the name cannot be checked.
+	require.NoError(t, os.WriteFile(filepath.Join(path, renamedWalletID.String(), renamedWalletID.String()), []byte("bad"), 0o600))
+	err = store.CreateWallet(otherWalletID, "another name", []byte(fmt.Sprintf(`{"name":"another name","uuid":%q}`, otherWalletID)))
+	require.Error(t, err)
+	require.False(t, errors.Is(err, filesystem.ErrWalletNameConflict))
+	_, err = os.Stat(filepath.Join(path, otherWalletID.String()))
+	require.True(t, os.IsNotExist(err))
+	require.NoError(t, store.DeleteWallet(renamedWalletID))
+
+	// Once the wallet is deleted the name can be used again.
+	require.NoError(t, store.DeleteWallet(walletID))
+	require.NoError(t, store.CreateWallet(otherWalletID, "validators", []byte(fmt.Sprintf(`{"name":"validators","uuid":%q}`, otherWalletID))))
+}
+
+func TestCreateWalletConcurrent(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	require.NoError(t, os.MkdirAll(path, 0o700))
+
+	const creators = 8
+	errs := make([]error, creators)
+	var wg sync.WaitGroup
+	for i := 0; i < creators; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+			walletID := uuid.New()
+			errs[i] = store.CreateWallet(walletID, "validators", []byte(fmt.Sprintf(`{"name":"validators","uuid":%q}`, walletID)))
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		require.True(t, errors.Is(err, filesystem.ErrWalletNameConflict))
+	}
+	require.Equal(t, 1, created)
+	wallets := 0
+	for range filesystem.New(filesystem.WithLocation(path)).RetrieveWallets() {
+		wallets++
+	}
+	require.Equal(t, 1, wallets)
+}
@@ -14,55 +14,308 @@
 package filesystem
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"errors"
+	"fmt"
+)
 
-	"github.com/wealdtech/go-ecodec"
+// The store encrypts data in the format used by go-ecodec, but derives keys
+// through a cache rather than once per item of data.
+const (
+	ecodecVersion          = byte(1)
+	ecodecVersionLen       = 1
+	ecodecSaltLen          = 32
+	ecodecIVLen            = 16
+	ecodecChecksumLen      = 32
+	ecodecHeaderLen        = ecodecVersionLen + ecodecSaltLen + ecodecIVLen + ecodecChecksumLen
+	ecodecPBKDF2Iterations = 262144
+	ecodecKeyLen           = 32
 )
 
-// encryptIfRequired encrypts data if required.
-func (s *Store) encryptIfRequired(data []byte) ([]byte, error) {
+// encryptIfRequired places data in an envelope, encrypting it if the store
+// has a passphrase or encryptor, or the wallet has its own passphrase.
+// Encrypted data is bound to the given location.
+func (s *Store) encryptIfRequired(binding *fileBinding, data []byte) ([]byte, error) {
+	encryptor, err := s.encryptorFor(binding.walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	return sealData(encryptor, binding, data)
+}
+
+// decryptIfRequired returns the data held in an envelope, decrypting it if required.
+// Data written by older versions of this module is not held in an envelope, and is
+// decrypted if the store has a passphrase.
+// Data encrypted with AES-256-GCM or an encryptor must have been encrypted for the
+// given location.  Data encrypted without a location is rejected once the store has
+// been upgraded to bind all of its data to its location.
+// Data in a wallet with its own passphrase that cannot be decrypted returns
+// ErrWalletLocked along with ErrDecryptionFailed.
+func (s *Store) decryptIfRequired(binding *fileBinding, data []byte) ([]byte, error) {
+	if err := s.checkBound(data); err != nil {
+		return nil, err
+	}
+	encryptor, err := s.decryptorFor(binding.walletID)
+	if err != nil {
+		return nil, err
+	}
+	if isEnvelope(data) {
+		plaintext, encrypted, err := unsealData(encryptor, binding, data)
+		if err != nil {
+			if errors.Is(err, ErrDecryptionFailed) && s.hasWalletPassphrase(binding.walletID) {
+				return nil, fmt.Errorf("%w: %w", ErrWalletLocked, err)
+			}
+			return nil, err
+		}
+		if encryptor != nil && !encrypted {
+			// Do not allow unencrypted data to take the place of encrypted data.
+			return nil, fmt.Errorf("%w: data is not encrypted", ErrDecryptionFailed)
+		}
+		return plaintext, nil
+	}
+
 	if len(data) == 0 {
-		// No data means nothing to encrypt.
+		// No data means nothing to decrypt.
 		return data, nil
 	}
 
-	if len(s.passphrase) == 0 {
-		// No passphrase means nothing to encrypt with.
+	if encryptor == nil {
+		// No passphrase means nothing to decrypt with.
 		return data, nil
 	}
 
 	if len(data) < 16 {
-		return nil, errors.New("data must be at least 16 bytes")
+		return nil, ErrDataTooShort
 	}
 
-	var err error
-	if data, err = ecodec.Encrypt(data, s.passphrase); err != nil {
-		return nil, err
+	passphraseEncryptor, isPassphraseEncryptor := encryptor.(*passphraseEncryptor)
+	if !isPassphraseEncryptor {
+		return nil, fmt.Errorf("%w: data written by an older version of this module requires a passphrase", ErrDecryptionFailed)
+	}
+	if data, err = ecodecDecrypt(passphraseEncryptor.keys, data); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
 	}
 
 	return data, nil
 }
 
-// decryptIfRequired decrypts data if required.
-func (s *Store) decryptIfRequired(data []byte) ([]byte, error) {
-	if len(data) == 0 {
-		// No data means nothing to decrypt.
-		return data, nil
+// checkBound returns an error if the data is encrypted without being bound to
+// its location and the store's format requires that all data is bound, as such
+// data could have been moved from elsewhere in the store.
+func (s *Store) checkBound(data []byte) error {
+	if !isUnbound(data) {
+		return nil
+	}
+	version, err := s.version()
+	if err != nil {
+		return err
+	}
+	if version >= boundStoreVersion {
+		return fmt.Errorf("%w: data is not bound to its location", ErrDecryptionFailed)
 	}
 
-	if len(s.passphrase) == 0 {
-		// No passphrase means nothing to decrypt with.
-		return data, nil
+	return nil
+}
+
+// storeEncryptor returns the encryptor for the store, or nil if the store
+// is not encrypted.
+func (s *Store) storeEncryptor() Encryptor {
+	s.keysMutex.Lock()
+	defer s.keysMutex.Unlock()
+
+	if s.encryptor != nil {
+		return s.encryptor
+	}
+	if len(s.passphrase) == 0 && s.passphraseFunc == nil {
+		return nil
 	}
 
-	if len(data) < 16 {
-		return nil, errors.New("data must be at least 16 bytes")
+	return &passphraseEncryptor{keys: s.derivedKeys()}
+}
+
+// sealData places data in an envelope, encrypted with the encryptor unless it
+// is nil.  Encrypted data is bound to the given location.
+func sealData(encryptor Encryptor, binding *fileBinding, data []byte) ([]byte, error) {
+	if encryptor == nil {
+		return sealEnvelope(&envelope{kind: envelopePlaintext, payload: data}), nil
 	}
 
-	var err error
-	if data, err = ecodec.Decrypt(data, s.passphrase); err != nil {
+	if passphraseEncryptor, isPassphraseEncryptor := encryptor.(*passphraseEncryptor); isPassphraseEncryptor {
+		env := &envelope{
+			kind:   envelopeEncrypted,
+			cipher: envelopeCipherAES256GCM,
+			kdf:    passphraseEncryptor.keys.kdf.envelopeKDF(),
+		}
+		var err error
+		env.payload, err = aeadEncrypt(passphraseEncryptor.keys, data, binding.associatedData(envelopePrefix(env.kind, env.cipher, env.kdf)))
+		if err != nil {
+			return nil, err
+		}
+		return sealEnvelope(env), nil
+	}
+
+	// The payload for an encryptor is prefixed with its name.
+	name := encryptor.Name()
+	if len(name) == 0 || len(name) > 255 {
+		return nil, fmt.Errorf("encryptor name must be between 1 and 255 bytes")
+	}
+	env := &envelope{
+		kind:   envelopeEncrypted,
+		cipher: envelopeCipherEncryptor,
+		kdf:    envelopeKDFNone,
+	}
+	associatedData := append(binding.associatedData(envelopePrefix(env.kind, env.cipher, env.kdf)), name...)
+	ciphertext, err := encryptor.Encrypt(data, associatedData)
+	if err != nil {
 		return nil, err
 	}
+	env.payload = make([]byte, 0, 1+len(name)+len(ciphertext))
+	env.payload = append(env.payload, byte(len(name)))
+	env.payload = append(env.payload, name...)
+	env.payload = append(env.payload, ciphertext...)
 
-	return data, nil
+	return sealEnvelope(env), nil
+}
+
+// unsealData returns the data held in an envelope, decrypting it with the
+// encryptor if it is encrypted, along with whether it was encrypted.
+func unsealData(encryptor Encryptor, binding *fileBinding, data []byte) ([]byte, bool, error) {
+	env, err := openEnvelope(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if env.kind == envelopePlaintext {
+		return env.payload, false, nil
+	}
+	if encryptor == nil {
+		return nil, true, fmt.Errorf("%w: %w", ErrDecryptionFailed, ErrPassphraseRequired)
+	}
+
+	var plaintext []byte
+	passphraseEncryptor, isPassphraseEncryptor := encryptor.(*passphraseEncryptor)
+	switch {
+	case env.cipher == envelopeCipherEncryptor:
+		name, ciphertext, err := splitEncryptorPayload(env.payload)
+		if err != nil {
+			return nil, true, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+		}
+		if name != encryptor.Name() {
+			return nil, true, fmt.Errorf("%w: data encrypted by %q rather than %q", ErrDecryptionFailed, name, encryptor.Name())
+		}
+		plaintext, err = encryptor.Decrypt(ciphertext, append(binding.associatedData(data[:envelopePrefixLen]), name...))
+		if err != nil {
+			return nil, true, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+		}
+		return plaintext, true, nil
+	case !isPassphraseEncryptor:
+		return nil, true, fmt.Errorf("%w: data encrypted with a passphrase", ErrDecryptionFailed)
+	case env.cipher == envelopeCipherAES128CTR:
+		plaintext, err = ecodecDecrypt(passphraseEncryptor.keys, env.payload)
+	default:
+		plaintext, err = aeadDecrypt(passphraseEncryptor.keys, env.kdf, env.payload, binding.associatedData(data[:envelopePrefixLen]))
+	}
+	if err != nil {
+		return nil, true, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
+
+	return plaintext, true, nil
+}
+
+// splitEncryptorPayload splits the payload written by an encryptor into the
+// name of the encryptor and the encrypted data.
+func splitEncryptorPayload(payload []byte) (string, []byte, error) {
+	if len(payload) < 1 || len(payload) < 1+int(payload[0]) {
+		return "", nil, errors.New("encryptor payload too short")
+	}
+
+	return string(payload[1 : 1+int(payload[0])]), payload[1+int(payload[0]):], nil
+}
+
+// derivedKeys returns the cache of keys derived from the store's passphrase.
+// The caller must hold keysMutex.
+func (s *Store) derivedKeys() *keyCache {
+	if s.keys == nil {
+		s.keys = newKeyCache(s.passphrase, s.kdf)
+		if len(s.passphrase) == 0 {
+			s.keys.passphraseFunc = s.passphraseFunc
+		}
+	}
+
+	return s.keys
+}
+
+// ecodecEncrypt encrypts data in the format used by go-ecodec.
+// Keys are always derived with the default parameters, as used by go-ecodec.
+func ecodecEncrypt(keys *keyCache, data []byte) ([]byte, error) {
+	if !keys.kdf.isDefault() {
+		return nil, errors.New("go-ecodec format requires the default key derivation parameters")
+	}
+	salt, key, err := keys.encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	defer zero(key)
+
+	res := make([]byte, ecodecHeaderLen+len(data))
+	res[0] = ecodecVersion
+	copy(res[ecodecVersionLen:], salt)
+	iv := res[ecodecVersionLen+ecodecSaltLen : ecodecVersionLen+ecodecSaltLen+ecodecIVLen]
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	aesCipher, err := aes.NewCipher(key[:16])
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewCTR(aesCipher, iv).XORKeyStream(res[ecodecHeaderLen:], data)
+
+	h := sha256.New()
+	h.Write(key[16:32])
+	h.Write(res[ecodecHeaderLen:])
+	copy(res[ecodecVersionLen+ecodecSaltLen+ecodecIVLen:], h.Sum(nil))
+
+	return res, nil
+}
+
+// ecodecDecrypt decrypts data in the format used by go-ecodec.
+func ecodecDecrypt(keys *keyCache, data []byte) ([]byte, error) {
+	if len(data) < ecodecHeaderLen {
+		return nil, fmt.Errorf("encrypted data must be at least %d bytes", ecodecHeaderLen)
+	}
+	if data[0] != ecodecVersion {
+		return nil, fmt.Errorf("unhandled version %#02x", data[0])
+	}
+
+	salt := data[ecodecVersionLen : ecodecVersionLen+ecodecSaltLen]
+	iv := data[ecodecVersionLen+ecodecSaltLen : ecodecVersionLen+ecodecSaltLen+ecodecIVLen]
+	checksum := data[ecodecVersionLen+ecodecSaltLen+ecodecIVLen : ecodecHeaderLen]
+	ciphertext := data[ecodecHeaderLen:]
+
+	key, err := keys.key(defaultKDFParams, salt)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(key)
+
+	h := sha256.New()
+	h.Write(key[16:32])
+	h.Write(ciphertext)
+	if subtle.ConstantTimeCompare(h.Sum(nil), checksum) != 1 {
+		return nil, errors.New("invalid key")
+	}
+
+	aesCipher, err := aes.NewCipher(key[:16])
+	if err != nil {
+		return nil, err
+	}
+	res := make([]byte, len(ciphertext))
+	cipher.NewCTR(aesCipher, iv).XORKeyStream(res, ciphertext)
+
+	return res, nil
 }
@@ -20,7 +20,9 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
+	ecodec "github.com/wealdtech/go-ecodec"
 )
 
 func TestEncryptIfRequired(t *testing.T) {
@@ -48,13 +50,12 @@ func TestEncryptIfRequired(t *testing.T) {
 			store: &Store{
 				passphrase: []byte("test passphrase"),
 			},
-			err: "data must be at least 16 bytes",
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			_, err := test.store.encryptIfRequired(test.data)
+			_, err := test.store.encryptIfRequired(walletBinding(uuid.New()), test.data)
 			if test.err != "" {
 				require.EqualError(t, err, test.err)
 			} else {
@@ -95,11 +96,73 @@ func TestDecryptIfRequired(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			_, err := test.store.decryptIfRequired(test.data)
+			_, err := test.store.decryptIfRequired(walletBinding(uuid.New()), test.data)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestEcodecDecrypt(t *testing.T) {
+	passphrase := []byte("test passphrase")
+	data := []byte(`{"name":"test account"}`)
+	encrypted, err := ecodec.Encrypt(data, passphrase)
+	require.NoError(t, err)
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(tampered)-1] ^= 0x01
+	badVersion := append([]byte{}, encrypted...)
+	badVersion[0] = 0x02
+
+	tests := []struct {
+		name       string
+		passphrase []byte
+		data       []byte
+		res        []byte
+		err        string
+	}{
+		{
+			name:       "Good",
+			passphrase: passphrase,
+			data:       encrypted,
+			res:        data,
+		},
+		{
+			name:       "ShortData",
+			passphrase: passphrase,
+			data:       encrypted[:ecodecHeaderLen-1],
+			err:        "encrypted data must be at least 81 bytes",
+		},
+		{
+			name:       "BadVersion",
+			passphrase: passphrase,
+			data:       badVersion,
+			err:        "unhandled version 0x02",
+		},
+		{
+			name:       "IncorrectPassphrase",
+			passphrase: []byte("other passphrase"),
+			data:       encrypted,
+			err:        "invalid key",
+		},
+		{
+			name:       "Tampered",
+			passphrase: passphrase,
+			data:       tampered,
+			err:        "invalid key",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := ecodecDecrypt(newKeyCache(test.passphrase, nil), test.data)
 			if test.err != "" {
 				require.EqualError(t, err, test.err)
 			} else {
 				require.NoError(t, err)
+				require.Equal(t, test.res, res)
 			}
 		})
 	}
@@ -14,6 +14,7 @@
 package filesystem_test
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -95,3 +96,23 @@ func TestBadWalletKey(t *testing.T) {
 	_, err = store.RetrieveWallet(walletName)
 	require.NotNil(t, err)
 }
+
+func TestBadAccountKey(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("test")))
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+
+	// Open account with store with different key; should fail with a decryption error.
+	store = filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("badkey")))
+	_, err := store.RetrieveAccount(walletID, accountID)
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+	require.False(t, errors.Is(err, filesystem.ErrAccountNotFound))
+}
@@ -0,0 +1,168 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Encryptor encrypts and decrypts the data held in the store.
+type Encryptor interface {
+	// Name returns the name of the encryption scheme.  The name is recorded
+	// with the data that it encrypts, so it must be unique and must not change.
+	Name() string
+	// Encrypt encrypts data, authenticating the associated data along with it.
+	Encrypt(data []byte, associatedData []byte) ([]byte, error)
+	// Decrypt decrypts data encrypted by Encrypt, returning an error if either
+	// the data or the associated data have been altered.
+	Decrypt(data []byte, associatedData []byte) ([]byte, error)
+}
+
+// passphraseEncryptor encrypts data with AES-256-GCM, using keys derived from
+// a passphrase.  This is the encryption used by WithPassphrase.
+type passphraseEncryptor struct {
+	keys *keyCache
+}
+
+// NewPassphraseEncryptor creates an encryptor that encrypts data with keys
+// derived from a passphrase, as used by WithPassphrase.
+func NewPassphraseEncryptor(passphrase []byte) Encryptor {
+	return &passphraseEncryptor{
+		keys: newKeyCache(passphrase, nil),
+	}
+}
+
+// Name returns the name of the encryption scheme.
+func (e *passphraseEncryptor) Name() string {
+	return "passphrase"
+}
+
+// Encrypt encrypts data, prefixing it with the envelope's identifier for the
+// key derivation function.
+func (e *passphraseEncryptor) Encrypt(data []byte, associatedData []byte) ([]byte, error) {
+	ciphertext, err := aeadEncrypt(e.keys, data, associatedData)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{e.keys.kdf.envelopeKDF()}, ciphertext...), nil
+}
+
+// Decrypt decrypts data.
+func (e *passphraseEncryptor) Decrypt(data []byte, associatedData []byte) ([]byte, error) {
+	if len(data) < 1 {
+		return nil, errors.New("encrypted data too short")
+	}
+
+	return aeadDecrypt(e.keys, data[0], data[1:], associatedData)
+}
+
+// keyEncryptor encrypts data with an AEAD cipher and a fixed key.
+type keyEncryptor struct {
+	name string
+	aead cipher.AEAD
+}
+
+// NewAESGCMEncryptor creates an encryptor that encrypts data with AES-256-GCM
+// using the given 32-byte key.
+func NewAESGCMEncryptor(key []byte) (Encryptor, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, not %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyEncryptor{
+		name: "key/aes-256-gcm",
+		aead: aead,
+	}, nil
+}
+
+// NewXChaCha20Poly1305Encryptor creates an encryptor that encrypts data with
+// XChaCha20-Poly1305 using the given 32-byte key.
+func NewXChaCha20Poly1305Encryptor(key []byte) (Encryptor, error) {
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, not %d", chacha20poly1305.KeySize, len(key))
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyEncryptor{
+		name: "key/xchacha20-poly1305",
+		aead: aead,
+	}, nil
+}
+
+// Name returns the name of the encryption scheme.
+func (e *keyEncryptor) Name() string {
+	return e.name
+}
+
+// Encrypt encrypts data, prefixing it with a random nonce.
+func (e *keyEncryptor) Encrypt(data []byte, associatedData []byte) ([]byte, error) {
+	res := make([]byte, e.aead.NonceSize(), e.aead.NonceSize()+len(data)+e.aead.Overhead())
+	if _, err := rand.Read(res); err != nil {
+		return nil, err
+	}
+
+	return e.aead.Seal(res, res, data, associatedData), nil
+}
+
+// Decrypt decrypts data.
+func (e *keyEncryptor) Decrypt(data []byte, associatedData []byte) ([]byte, error) {
+	if len(data) < e.aead.NonceSize() {
+		return nil, errors.New("encrypted data too short")
+	}
+	ciphertext := data[e.aead.NonceSize():]
+
+	return e.aead.Open(make([]byte, 0, len(ciphertext)), data[:e.aead.NonceSize()], ciphertext, associatedData)
+}
+
+// noopEncryptor does not encrypt data.
+type noopEncryptor struct{}
+
+// NewNoopEncryptor creates an encryptor that does not encrypt data.  A store
+// with this encryptor is unencrypted, as if it did not have a passphrase.
+func NewNoopEncryptor() Encryptor {
+	return &noopEncryptor{}
+}
+
+// Name returns the name of the encryption scheme.
+func (*noopEncryptor) Name() string {
+	return "none"
+}
+
+// Encrypt returns the data unaltered.
+func (*noopEncryptor) Encrypt(data []byte, _ []byte) ([]byte, error) {
+	return data, nil
+}
+
+// Decrypt returns the data unaltered.
+func (*noopEncryptor) Decrypt(data []byte, _ []byte) ([]byte, error) {
+	return data, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+func TestEncryptors(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+	aesGCMEncryptor, err := filesystem.NewAESGCMEncryptor(key)
+	require.NoError(t, err)
+	otherAESGCMEncryptor, err := filesystem.NewAESGCMEncryptor(bytes.Repeat([]byte{0x02}, 32))
+	require.NoError(t, err)
+	xChaCha20Poly1305Encryptor, err := filesystem.NewXChaCha20Poly1305Encryptor(key)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		encryptor filesystem.Encryptor
+		wrong     filesystem.Encryptor
+		encrypted bool
+	}{
+		{
+			name:      "Passphrase",
+			encryptor: filesystem.NewPassphraseEncryptor([]byte("test")),
+			wrong:     filesystem.NewPassphraseEncryptor([]byte("wrong")),
+			encrypted: true,
+		},
+		{
+			name:      "AESGCM",
+			encryptor: aesGCMEncryptor,
+			wrong:     otherAESGCMEncryptor,
+			encrypted: true,
+		},
+		{
+			name:      "XChaCha20Poly1305",
+			encryptor: xChaCha20Poly1305Encryptor,
+			wrong:     aesGCMEncryptor,
+			encrypted: true,
+		},
+		{
+			name:      "Noop",
+			encryptor: filesystem.NewNoopEncryptor(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+			defer os.RemoveAll(path)
+			store, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithCreate(true), filesystem.WithEncryptor(test.encryptor))
+			require.NoError(t, err)
+
+			walletID := uuid.New()
+			walletName := "test wallet"
+			walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+			require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+			accountID := uuid.New()
+			accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+			require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+
+			// Data is readable by a new store with the same encryptor.
+			store, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithEncryptor(test.encryptor))
+			require.NoError(t, err)
+			data, err := store.RetrieveWallet(walletName)
+			require.NoError(t, err)
+			require.Equal(t, walletData, data)
+			data, err = store.RetrieveAccount(walletID, accountID)
+			require.NoError(t, err)
+			require.Equal(t, accountData, data)
+
+			raw, err := os.ReadFile(filepath.Join(path, walletID.String(), accountID.String()))
+			require.NoError(t, err)
+			if !test.encrypted {
+				require.True(t, bytes.Contains(raw, accountData))
+				// The store is the same as one without a passphrase.
+				_, err = filesystem.Open(filesystem.WithLocation(path))
+				require.NoError(t, err)
+				return
+			}
+			require.False(t, bytes.Contains(raw, accountData))
+
+			// Data cannot be read with the wrong encryptor.
+			_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithEncryptor(test.wrong))
+			require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+			wrongStore := filesystem.New(filesystem.WithLocation(path), filesystem.WithEncryptor(test.wrong)).(*filesystem.Store)
+			_, err = wrongStore.RetrieveAccount(walletID, accountID)
+			require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+			_, err = filesystem.Open(filesystem.WithLocation(path))
+			require.True(t, errors.Is(err, filesystem.ErrPassphraseRequired))
+
+			// Data is bound to its location.
+			otherAccountID := uuid.New()
+			copyFile(t, filepath.Join(path, walletID.String(), accountID.String()), filepath.Join(path, walletID.String(), otherAccountID.String()))
+			_, err = store.RetrieveAccount(walletID, otherAccountID)
+			require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+		})
+	}
+}
+
+func TestPassphraseEncryptor(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+
+	// A store with the passphrase encryptor is the same as one with the passphrase.
+	store, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithCreate(true), filesystem.WithEncryptor(filesystem.NewPassphraseEncryptor(passphrase)))
+	require.NoError(t, err)
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+
+	store, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+	require.NoError(t, err)
+	data, err := store.RetrieveWallet(walletName)
+	require.NoError(t, err)
+	require.Equal(t, walletData, data)
+	require.NoError(t, store.ChangePassphrase(passphrase, []byte("new passphrase")))
+}
+
+func TestKeyEncryptorBadKey(t *testing.T) {
+	_, err := filesystem.NewAESGCMEncryptor(make([]byte, 16))
+	require.EqualError(t, err, "key must be 32 bytes, not 16")
+	_, err = filesystem.NewXChaCha20Poly1305Encryptor(nil)
+	require.EqualError(t, err, "key must be 32 bytes, not 0")
+}
+
+func TestEncryptorChangePassphrase(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	encryptor, err := filesystem.NewAESGCMEncryptor(bytes.Repeat([]byte{0x01}, 32))
+	require.NoError(t, err)
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithEncryptor(encryptor)).(*filesystem.Store)
+
+	require.EqualError(t, store.ChangePassphrase([]byte("old"), []byte("new")), "store does not use a passphrase")
+}
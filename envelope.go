@@ -0,0 +1,156 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// Data in the store is held in an envelope that describes its contents, so
+// that it can be read without relying on the length or form of the data.
+// An envelope is laid out as:
+//
+//	magic    4 bytes  "E2WS"
+//	version  1 byte
+//	type     1 byte   plaintext or encrypted
+//	cipher   1 byte   cipher used to encrypt the payload, if encrypted
+//	kdf      1 byte   function used to derive the key, if encrypted
+//	checksum 4 bytes  CRC-32C of the preceding fields and the payload
+//	payload
+//
+// Encrypted payloads start with the parameters of the key derivation function,
+// unless it is PBKDF2 with the parameters used by go-ecodec.
+//
+// Encrypted payloads written by AES-256-GCM authenticate the fields before
+// the checksum along with the location of the data in the store.
+// Files written by older versions of this module do not have an envelope.
+const (
+	envelopeMagic     = "E2WS"
+	envelopeVersion   = byte(1)
+	envelopePrefixLen = 8
+	envelopeHeaderLen = 12
+)
+
+// Types of envelope.
+const (
+	envelopePlaintext = byte(0)
+	envelopeEncrypted = byte(1)
+)
+
+// Ciphers used to encrypt envelope payloads.
+const (
+	envelopeCipherNone      = byte(0)
+	envelopeCipherAES128CTR = byte(1)
+	envelopeCipherAES256GCM = byte(2)
+	// envelopeCipherEncryptor is used for data encrypted by an Encryptor,
+	// whose payload starts with the length and name of the encryptor.
+	envelopeCipherEncryptor = byte(3)
+)
+
+// Key derivation functions used to obtain the keys for envelope payloads.
+const (
+	envelopeKDFNone         = byte(0)
+	envelopeKDFPBKDF2SHA256 = byte(1)
+	// The following functions record their parameters at the start of the payload.
+	envelopeKDFPBKDF2SHA256Params = byte(2)
+	envelopeKDFScrypt             = byte(3)
+	envelopeKDFArgon2id           = byte(4)
+)
+
+var envelopeChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// envelope is the decoded form of an envelope.
+type envelope struct {
+	kind    byte
+	cipher  byte
+	kdf     byte
+	payload []byte
+}
+
+// isEnvelope returns true if the data is held in an envelope.
+func isEnvelope(data []byte) bool {
+	return len(data) >= envelopeHeaderLen && bytes.HasPrefix(data, []byte(envelopeMagic))
+}
+
+// envelopePrefix returns the fields of an envelope's header that precede the checksum.
+func envelopePrefix(kind byte, cipher byte, kdf byte) []byte {
+	return append([]byte(envelopeMagic), envelopeVersion, kind, cipher, kdf)
+}
+
+// sealEnvelope encodes an envelope.
+func sealEnvelope(env *envelope) []byte {
+	res := make([]byte, envelopeHeaderLen+len(env.payload))
+	copy(res, envelopePrefix(env.kind, env.cipher, env.kdf))
+	copy(res[envelopeHeaderLen:], env.payload)
+	binary.BigEndian.PutUint32(res[8:envelopeHeaderLen], envelopeChecksum(res))
+
+	return res
+}
+
+// openEnvelope decodes an envelope, checking its checksum.
+func openEnvelope(data []byte) (*envelope, error) {
+	if !isEnvelope(data) {
+		return nil, fmt.Errorf("%w: not an envelope", ErrCorruptData)
+	}
+	if data[4] != envelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %d", data[4])
+	}
+	if binary.BigEndian.Uint32(data[8:envelopeHeaderLen]) != envelopeChecksum(data) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptData)
+	}
+
+	env := &envelope{
+		kind:    data[5],
+		cipher:  data[6],
+		kdf:     data[7],
+		payload: data[envelopeHeaderLen:],
+	}
+	switch env.kind {
+	case envelopePlaintext:
+		if env.cipher != envelopeCipherNone || env.kdf != envelopeKDFNone {
+			return nil, fmt.Errorf("%w: plaintext envelope with cipher or key derivation function", ErrCorruptData)
+		}
+	case envelopeEncrypted:
+		switch env.cipher {
+		case envelopeCipherAES128CTR:
+			if env.kdf != envelopeKDFPBKDF2SHA256 {
+				return nil, fmt.Errorf("unsupported key derivation function %d", env.kdf)
+			}
+		case envelopeCipherAES256GCM:
+			if env.kdf < envelopeKDFPBKDF2SHA256 || env.kdf > envelopeKDFArgon2id {
+				return nil, fmt.Errorf("unsupported key derivation function %d", env.kdf)
+			}
+		case envelopeCipherEncryptor:
+			if env.kdf != envelopeKDFNone {
+				return nil, fmt.Errorf("%w: encryptor envelope with key derivation function", ErrCorruptData)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported cipher %d", env.cipher)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported envelope type %d", env.kind)
+	}
+
+	return env, nil
+}
+
+// envelopeChecksum calculates the checksum of an encoded envelope.
+func envelopeChecksum(data []byte) uint32 {
+	checksum := crc32.Update(0, envelopeChecksumTable, data[:envelopePrefixLen])
+
+	return crc32.Update(checksum, envelopeChecksumTable, data[envelopeHeaderLen:])
+}
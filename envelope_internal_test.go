@@ -0,0 +1,155 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	passphrase := []byte("test passphrase")
+	encryptedStore := &Store{passphrase: passphrase}
+	plaintextStore := &Store{}
+	binding := accountBinding(uuid.New(), uuid.New())
+
+	for _, data := range [][]byte{
+		{},
+		[]byte("[]"),
+		[]byte(`{"test":true}`),
+		[]byte(`{"test":true,"padding":"0123456789abcdef0123456789abcdef"}`),
+	} {
+		t.Run(fmt.Sprintf("%d", len(data)), func(t *testing.T) {
+			// Encrypted.
+			sealed, err := encryptedStore.encryptIfRequired(binding, data)
+			require.NoError(t, err)
+			require.True(t, isEnvelope(sealed))
+			require.True(t, isEncrypted(sealed))
+			opened, err := encryptedStore.decryptIfRequired(binding, sealed)
+			require.NoError(t, err)
+			require.Equal(t, data, opened)
+			_, err = plaintextStore.decryptIfRequired(binding, sealed)
+			require.True(t, errors.Is(err, ErrPassphraseRequired))
+
+			// Plaintext.
+			sealed, err = plaintextStore.encryptIfRequired(binding, data)
+			require.NoError(t, err)
+			require.True(t, isEnvelope(sealed))
+			require.False(t, isEncrypted(sealed))
+			opened, err = plaintextStore.decryptIfRequired(binding, sealed)
+			require.NoError(t, err)
+			require.Equal(t, data, opened)
+			// Plaintext cannot take the place of encrypted data.
+			_, err = encryptedStore.decryptIfRequired(binding, sealed)
+			require.True(t, errors.Is(err, ErrDecryptionFailed))
+		})
+	}
+}
+
+func TestEnvelopeCorrupt(t *testing.T) {
+	sealed, err := sealData(NewPassphraseEncryptor([]byte("test passphrase")), walletBinding(uuid.New()), []byte(`{"test":true}`))
+	require.NoError(t, err)
+
+	for i := range sealed {
+		if i < len(envelopeMagic) {
+			// Altering the magic means the data is not an envelope.
+			continue
+		}
+		corrupt := copyBytes(sealed)
+		corrupt[i] ^= 0x01
+		_, err := openEnvelope(corrupt)
+		require.Error(t, err, fmt.Sprintf("byte %d", i))
+	}
+}
+
+func TestLegacyData(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test passphrase")
+	store := New(WithLocation(path), WithPassphrase(passphrase)).(*Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	// Older versions of this module did not write metadata.
+	require.NoError(t, os.Remove(store.storeMetadataPath()))
+
+	// Account encrypted without an envelope.
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	encryptedAccountData, err := ecodecEncrypt(newKeyCache(passphrase, nil), accountData)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(store.accountPath(walletID, accountID), encryptedAccountData, 0o600))
+	data, err := store.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, data)
+
+	// Empty index without an envelope.
+	require.NoError(t, os.WriteFile(store.walletIndexPath(walletID), []byte("[]"), 0o600))
+	data, err = store.RetrieveAccountsIndex(walletID)
+	require.NoError(t, err)
+	require.Equal(t, []byte("[]"), data)
+
+	// Empty index is now encrypted.
+	require.NoError(t, store.StoreAccountsIndex(walletID, []byte("[]")))
+	onDisk, err := os.ReadFile(store.walletIndexPath(walletID))
+	require.NoError(t, err)
+	require.True(t, isEncrypted(onDisk))
+	data, err = store.RetrieveAccountsIndex(walletID)
+	require.NoError(t, err)
+	require.Equal(t, []byte("[]"), data)
+
+	// Account encrypted with AES-128-CTR in an envelope.
+	ctrAccountID := uuid.New()
+	ctrAccountData := []byte(fmt.Sprintf(`{"name":"ctr account","uuid":%q}`, ctrAccountID.String()))
+	payload, err := ecodecEncrypt(newKeyCache(passphrase, nil), ctrAccountData)
+	require.NoError(t, err)
+	ctrEncryptedAccountData := sealEnvelope(&envelope{kind: envelopeEncrypted, cipher: envelopeCipherAES128CTR, kdf: envelopeKDFPBKDF2SHA256, payload: payload})
+	require.NoError(t, os.WriteFile(store.accountPath(walletID, ctrAccountID), ctrEncryptedAccountData, 0o600))
+	data, err = store.RetrieveAccount(walletID, ctrAccountID)
+	require.NoError(t, err)
+	require.Equal(t, ctrAccountData, data)
+
+	// Opening the store binds the data to its location.
+	store, err = Open(WithLocation(path), WithPassphrase(passphrase))
+	require.NoError(t, err)
+	version, err := store.version()
+	require.NoError(t, err)
+	require.Equal(t, uint64(storeVersion), version)
+	for id, expected := range map[uuid.UUID][]byte{accountID: accountData, ctrAccountID: ctrAccountData} {
+		onDisk, err := os.ReadFile(store.accountPath(walletID, id))
+		require.NoError(t, err)
+		require.False(t, isUnbound(onDisk))
+		data, err := store.RetrieveAccount(walletID, id)
+		require.NoError(t, err)
+		require.Equal(t, expected, data)
+	}
+
+	// Data that is not bound to its location is no longer accepted.
+	for _, unbound := range [][]byte{encryptedAccountData, ctrEncryptedAccountData} {
+		require.NoError(t, os.WriteFile(store.accountPath(walletID, accountID), unbound, 0o600))
+		_, err = store.RetrieveAccount(walletID, accountID)
+		require.True(t, errors.Is(err, ErrDecryptionFailed))
+		err = store.ChangePassphrase(passphrase, []byte("new passphrase"))
+		require.True(t, errors.Is(err, ErrDecryptionFailed))
+	}
+}
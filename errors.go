@@ -0,0 +1,120 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ErrWalletNotFound is returned when a wallet is not present in the store.
+var ErrWalletNotFound = errors.New("wallet not found")
+
+// ErrAccountNotFound is returned when an account is not present in the store.
+var ErrAccountNotFound = errors.New("account not found")
+
+// ErrWalletExists is returned when creating a wallet that is already present in the store.
+var ErrWalletExists = errors.New("wallet exists")
+
+// ErrWalletNameConflict is matched by WalletNameConflictError, returned when
+// creating a wallet whose name is already used by another wallet.
+var ErrWalletNameConflict = errors.New("wallet name conflict")
+
+// ErrAccountNameConflict is matched by AccountNameConflictError, returned when an
+// account's name is already used by another account in the same wallet.
+var ErrAccountNameConflict = errors.New("account name conflict")
+
+// ErrIndexNotFound is returned when a wallet does not have an accounts index.
+var ErrIndexNotFound = errors.New("index not found")
+
+// ErrBatchNotFound is returned when a wallet does not have a batch.
+var ErrBatchNotFound = errors.New("batch not found")
+
+// ErrDecryptionFailed is returned when data in the store cannot be decrypted,
+// most commonly because the store passphrase is incorrect.
+var ErrDecryptionFailed = errors.New("decryption failed")
+
+// ErrDataTooShort is returned when data is too short to be encrypted or decrypted.
+var ErrDataTooShort = errors.New("data must be at least 16 bytes")
+
+// ErrLockUnavailable is returned when a lock on the store or a wallet cannot be
+// obtained within the lock timeout, or immediately when try-lock is in force.
+var ErrLockUnavailable = errors.New("lock unavailable")
+
+// ErrLeaseHeld is matched by LeaseHeldError, returned when a wallet lease is held elsewhere.
+var ErrLeaseHeld = errors.New("wallet lease held")
+
+// ErrPassphraseRequired is returned when opening an encrypted store without a passphrase.
+var ErrPassphraseRequired = errors.New("passphrase required")
+
+// ErrIncorrectPassphrase is returned when opening an encrypted store with the wrong passphrase.
+var ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+
+// ErrStoreNotEncrypted is returned when opening an unencrypted store with a passphrase.
+var ErrStoreNotEncrypted = errors.New("store is not encrypted")
+
+// ErrLocationNotFound is returned when opening a store whose location does not exist.
+var ErrLocationNotFound = errors.New("location not found")
+
+// ErrInsecureLocation is returned when opening a store whose location is owned by,
+// or can be modified by, another user.
+var ErrInsecureLocation = errors.New("insecure location")
+
+// ErrUnsupportedVersion is returned when a store's format is newer than this module supports.
+var ErrUnsupportedVersion = errors.New("unsupported store version")
+
+// ErrInsecurePassphraseFile is returned when a passphrase file is accessible by other users.
+var ErrInsecurePassphraseFile = errors.New("insecure passphrase file")
+
+// ErrWalletLocked is returned when a wallet is encrypted with its own passphrase,
+// and the passphrase has not been supplied or is incorrect.
+var ErrWalletLocked = errors.New("wallet locked")
+
+// ErrKeySlotNotFound is returned when a key slot is not present in the store.
+var ErrKeySlotNotFound = errors.New("key slot not found")
+
+// ErrNoKeySlots is returned when a store is opened with key slots but does not
+// have them; a store encrypted with a passphrase can be converted to key slots
+// with ConvertToKeySlots.
+var ErrNoKeySlots = errors.New("store does not have key slots")
+
+// ErrCorruptData is returned when data in the store fails its integrity checks.
+var ErrCorruptData = errors.New("data corrupt")
+
+// UnreadableAccountsError is returned when an accounts index is rebuilt but some
+// of the wallet's accounts could not be read.  The index is still written, and
+// holds the accounts that could be read.
+type UnreadableAccountsError struct {
+	// IDs are the IDs of the accounts that could not be read.
+	IDs  []uuid.UUID
+	errs []error
+}
+
+// Error returns the IDs of the unreadable accounts along with their errors.
+func (e *UnreadableAccountsError) Error() string {
+	ids := make([]string, len(e.IDs))
+	for i := range e.IDs {
+		ids[i] = e.IDs[i].String()
+	}
+
+	return fmt.Sprintf("failed to read accounts %s: %v", strings.Join(ids, ", "), errors.Join(e.errs...))
+}
+
+// Unwrap returns the errors from reading the unreadable accounts.
+func (e *UnreadableAccountsError) Unwrap() []error {
+	return e.errs
+}
@@ -0,0 +1,223 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tempFilePrefix is the prefix for temporary files created during writes.
+const tempFilePrefix = ".tmp-"
+
+// staleTempFileAge is the age after which a temporary file is considered to
+// have been left behind by an interrupted write.
+const staleTempFileAge = 10 * time.Minute
+
+// isTempFile returns true if the name is that of a temporary file.
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, tempFilePrefix)
+}
+
+// writeFile writes data to the given path in a crash-safe manner.
+// The data is written to a temporary file in the same directory, synced, and
+// renamed over the target, after which the directory itself is synced.  A
+// reader will see either the old or the new contents of the file, never a
+// partial write.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmpPath, err := writeTempFile(path, data, perm)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "failed to rename temporary file")
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// createFile writes data to the given path in the same manner as writeFile,
+// but only if the file does not already exist.  If it does, an error
+// satisfying os.IsExist is returned and the existing file is untouched.
+func createFile(path string, data []byte, perm os.FileMode) error {
+	tmpPath, err := writeTempFile(path, data, perm)
+	if err != nil {
+		return err
+	}
+	// Linking, unlike renaming, fails if the target exists.
+	err = os.Link(tmpPath, path)
+	_ = os.Remove(tmpPath)
+	if err != nil {
+		if os.IsExist(err) {
+			return err
+		}
+		return errors.Wrap(err, "failed to link temporary file")
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// writeTempFile writes data to a synced temporary file alongside the given
+// path, returning the path of the temporary file.
+func writeTempFile(path string, data []byte, perm os.FileMode) (string, error) {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), tempFilePrefix+filepath.Base(path)+"-*")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create temporary file")
+	}
+	tmpPath := tmpFile.Name()
+	success := false
+	defer func() {
+		if !success {
+			_ = tmpFile.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		return "", errors.Wrap(err, "failed to write temporary file")
+	}
+	if err := tmpFile.Chmod(perm); err != nil && runtime.GOOS != "windows" {
+		return "", errors.Wrap(err, "failed to set permissions on temporary file")
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return "", errors.Wrap(err, "failed to sync temporary file")
+	}
+	if err := tmpFile.Close(); err != nil {
+		return "", errors.Wrap(err, "failed to close temporary file")
+	}
+	success = true
+
+	return tmpPath, nil
+}
+
+// removeFile removes the file at the given path, syncing its directory so
+// that the removal is durable.
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// removeDir removes the directory at the given path and all of its contents.
+// The directory is first renamed to a temporary name so that it disappears
+// from the store atomically; if the removal is interrupted the remains are
+// tidied by CleanTempFiles.
+func removeDir(path string) error {
+	parent := filepath.Dir(path)
+	tmpPath := filepath.Join(parent, fmt.Sprintf("%s%s-%d", tempFilePrefix, filepath.Base(path), time.Now().UnixNano()))
+	if err := os.Rename(path, tmpPath); err != nil {
+		return err
+	}
+	if err := syncDir(parent); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(tmpPath)
+}
+
+// syncDir syncs a directory, ensuring that any renames or removals within it
+// are durable.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		// Windows does not support syncing directories.
+		return nil
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to open directory")
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync directory")
+	}
+
+	return nil
+}
+
+// CleanTempFiles removes temporary files left behind by interrupted writes.
+// Only temporary files that have not been modified recently are removed, to
+// avoid interfering with writes that are still in progress.
+func (s *Store) CleanTempFiles() error {
+	unlock, err := s.lockStore(true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock store")
+	}
+	defer unlock()
+
+	dirs, err := os.ReadDir(s.location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to read store")
+	}
+
+	if err := removeStaleTempFiles(s.location, dirs); err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || isTempFile(dir.Name()) {
+			continue
+		}
+		path := filepath.Join(s.location, dir.Name())
+		files, err := os.ReadDir(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed since the store was read.
+				continue
+			}
+			return errors.Wrap(err, "failed to read wallet directory")
+		}
+		if err := removeStaleTempFiles(path, files); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeStaleTempFiles removes stale temporary files and directories from the given entries in a directory.
+func removeStaleTempFiles(dir string, entries []os.DirEntry) error {
+	for _, entry := range entries {
+		if !isTempFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed or renamed since the directory was read.
+				continue
+			}
+			return errors.Wrap(err, "failed to obtain temporary file information")
+		}
+		if time.Since(info.ModTime()) < staleTempFileAge {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return errors.Wrap(err, "failed to remove temporary file")
+		}
+	}
+
+	return nil
+}
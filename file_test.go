@@ -0,0 +1,85 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+func TestNoTempFilesAfterWrite(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path))
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+	require.NoError(t, store.StoreAccountsIndex(walletID, []byte("[]")))
+
+	files, err := os.ReadDir(filepath.Join(path, walletID.String()))
+	require.NoError(t, err)
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	require.ElementsMatch(t, []string{walletID.String(), accountID.String(), "index"}, names)
+}
+
+func TestTempFilesIgnoredAndCleaned(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path))
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+
+	// Simulate writes that were interrupted, one long ago and one recently.
+	staleTemp := filepath.Join(path, walletID.String(), ".tmp-"+uuid.New().String()+"-123")
+	require.NoError(t, os.WriteFile(staleTemp, []byte(`{"name":"partial`), 0o600))
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(staleTemp, old, old))
+	recentTemp := filepath.Join(path, walletID.String(), ".tmp-"+uuid.New().String()+"-456")
+	require.NoError(t, os.WriteFile(recentTemp, []byte(`{"name":"partial`), 0o600))
+
+	accounts := 0
+	for range store.RetrieveAccounts(walletID) {
+		accounts++
+	}
+	require.Equal(t, 1, accounts)
+
+	require.NoError(t, store.(*filesystem.Store).CleanTempFiles())
+	_, err := os.Stat(staleTemp)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(recentTemp)
+	require.NoError(t, err)
+}
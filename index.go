@@ -14,44 +14,234 @@
 package filesystem
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/wealdtech/go-indexer"
 )
 
 // StoreAccountsIndex stores the account index.
 func (s *Store) StoreAccountsIndex(walletID uuid.UUID, data []byte) error {
+	unlock, err := s.lockWallet(walletID, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
+	if err := s.ensureWalletPathExists(walletID); err != nil {
+		return errors.Wrap(err, "wallet path does not exist")
+	}
+
+	return s.trackAccountNames(walletID, uuid.Nil, "", func() error {
+		return s.storeAccountsIndex(walletID, data)
+	})
+}
+
+// storeAccountsIndex stores the account index without obtaining locks.
+func (s *Store) storeAccountsIndex(walletID uuid.UUID, data []byte) error {
 	// Ensure wallet path exists.
 	var err error
 	if err = s.ensureWalletPathExists(walletID); err != nil {
 		return errors.Wrap(err, "wallet path does not exist")
 	}
 
-	// Do not encrypt empty index.
-	if len(data) != 2 {
-		data, err = s.encryptIfRequired(data)
-		if err != nil {
-			return errors.Wrap(err, "failed to encrypt index")
-		}
+	data, err = s.encryptIfRequired(indexBinding(walletID), data)
+	if err != nil {
+		return errors.Wrap(err, "failed to encrypt index")
 	}
 
 	path := s.walletIndexPath(walletID)
 
-	return os.WriteFile(path, data, 0o600)
+	return writeFile(path, data, 0o600)
 }
 
 // RetrieveAccountsIndex retrieves the account index.
 func (s *Store) RetrieveAccountsIndex(walletID uuid.UUID) ([]byte, error) {
+	unlock, err := s.lockWallet(walletID, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
+	return s.retrieveAccountsIndex(walletID)
+}
+
+// RebuildAccountsIndex rebuilds the accounts index for a wallet from its
+// accounts, replacing any existing index.  Accounts that cannot be read are
+// left out of the index and returned as an *UnreadableAccountsError, after the
+// index of the remaining accounts has been written.
+func (s *Store) RebuildAccountsIndex(walletID uuid.UUID) error {
+	unlock, err := s.lockWallet(walletID, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
+	// Ensure the wallet exists.
+	if _, err := s.retrieveWalletByID(walletID); err != nil {
+		return errors.Wrap(err, "unable to retrieve wallet")
+	}
+
+	index, scanErr := s.scanAccountsIndex(walletID)
+	var unreadable *UnreadableAccountsError
+	if scanErr != nil && !errors.As(scanErr, &unreadable) {
+		return scanErr
+	}
+	data, err := s.encodeAccountsIndex(walletID, index)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(s.walletIndexPath(walletID), data, 0o600); err != nil {
+		return err
+	}
+
+	return scanErr
+}
+
+// retrieveAccountsIndex retrieves the account index without obtaining locks.
+func (s *Store) retrieveAccountsIndex(walletID uuid.UUID) ([]byte, error) {
 	path := s.walletIndexPath(walletID)
 	data, err := os.ReadFile(path)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %w", ErrIndexNotFound, err)
+		}
 		return nil, errors.Wrap(err, "failed to read wallet index")
 	}
-	// Do not decrypt empty index.
-	if len(data) == 2 {
+	// Older versions of this module did not encrypt an empty index.
+	if !isEnvelope(data) && len(data) == 2 {
 		return data, nil
 	}
 
-	return s.decryptIfRequired(data)
+	data, err = s.decryptIfRequired(indexBinding(walletID), data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt index")
+	}
+
+	return data, nil
+}
+
+// accountsIndexForUpdate returns the accounts index for the wallet, building
+// it from the wallet's accounts if it does not exist.  Accounts that cannot be
+// read are left out of a built index, rather than preventing updates to the
+// wallet.  The caller must hold an exclusive lock on the wallet.
+func (s *Store) accountsIndexForUpdate(walletID uuid.UUID) (*indexer.Index, error) {
+	data, err := s.retrieveAccountsIndex(walletID)
+	if err != nil {
+		if errors.Is(err, ErrIndexNotFound) {
+			index, err := s.scanAccountsIndex(walletID)
+			var unreadable *UnreadableAccountsError
+			if err != nil && !errors.As(err, &unreadable) {
+				return nil, err
+			}
+			return index, nil
+		}
+		return nil, err
+	}
+	index, err := indexer.Deserialize(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse accounts index")
+	}
+
+	return index, nil
+}
+
+// scanAccountsIndex builds an accounts index from the wallet's accounts.
+// Accounts that cannot be read are left out of the index, and returned along
+// with it as an *UnreadableAccountsError.
+// The caller must hold a lock on the wallet.
+func (s *Store) scanAccountsIndex(walletID uuid.UUID) (*indexer.Index, error) {
+	walletPath := s.walletPath(walletID)
+	index := indexer.New()
+	unreadable := &UnreadableAccountsError{}
+	var err error
+	s.walkAccounts(context.Background(), walletID, false, func(res *RetrieveResult) bool {
+		if res.Path == walletPath {
+			// The wallet itself could not be read.
+			err = res.Err
+			return false
+		}
+		accountID, parseErr := uuid.Parse(filepath.Base(res.Path))
+		if parseErr != nil {
+			// Not an account.
+			return true
+		}
+		if res.Err != nil {
+			unreadable.IDs = append(unreadable.IDs, accountID)
+			unreadable.errs = append(unreadable.errs, res.Err)
+			return true
+		}
+		if name := nameOf(res.Data); name != "" {
+			index.Add(accountID, name)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read accounts")
+	}
+	if len(unreadable.IDs) > 0 {
+		return index, unreadable
+	}
+
+	return index, nil
+}
+
+// encodeAccountsIndex serializes and encrypts an accounts index.
+func (s *Store) encodeAccountsIndex(walletID uuid.UUID, index *indexer.Index) ([]byte, error) {
+	data, err := index.Serialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to serialize accounts index")
+	}
+	data, err = s.encryptIfRequired(indexBinding(walletID), data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt index")
+	}
+
+	return data, nil
+}
+
+// removeIndexEntry removes the entry with the given ID from the index.
+func removeIndexEntry(index *indexer.Index, id uuid.UUID) {
+	name, exists := index.Name(id)
+	if !exists {
+		return
+	}
+	nameID, nameExists := index.ID(name)
+	index.Remove(id, name)
+	if nameExists && nameID != id {
+		// Another entry has the same name.
+		index.Add(nameID, name)
+	}
+}
+
+// removeFromAccountsIndex removes an account from the accounts index, if the
+// index exists.  The caller must hold an exclusive lock on the wallet.
+func (s *Store) removeFromAccountsIndex(walletID uuid.UUID, accountID uuid.UUID) error {
+	if _, err := os.Stat(s.walletIndexPath(walletID)); os.IsNotExist(err) {
+		// No index to update.
+		return nil
+	}
+
+	data, err := s.retrieveAccountsIndex(walletID)
+	if err != nil {
+		return err
+	}
+	index, err := indexer.Deserialize(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse accounts index")
+	}
+	if _, exists := index.Name(accountID); !exists {
+		return nil
+	}
+	removeIndexEntry(index, accountID)
+	data, err = index.Serialize()
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize accounts index")
+	}
+
+	return s.storeAccountsIndex(walletID, data)
 }
@@ -14,6 +14,7 @@
 package filesystem_test
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -65,3 +66,77 @@ func TestStoreRetrieveIndex(t *testing.T) {
 	require.Equal(t, true, exists)
 	require.Equal(t, accountID, fetchedAccountID)
 }
+
+func TestRetrieveNonExistentIndex(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path))
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+
+	_, err := store.RetrieveAccountsIndex(walletID)
+	require.True(t, errors.Is(err, filesystem.ErrIndexNotFound))
+}
+
+func TestRebuildAccountsIndex(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("test"))).(*filesystem.Store)
+
+	require.True(t, errors.Is(store.RebuildAccountsIndex(uuid.New()), filesystem.ErrWalletNotFound))
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	accounts := make(map[uuid.UUID]string)
+	for i := 0; i < 3; i++ {
+		accountID := uuid.New()
+		accounts[accountID] = fmt.Sprintf("account %d", i)
+		require.NoError(t, store.StoreAccount(walletID, accountID, []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, accounts[accountID], accountID))))
+	}
+
+	// Corrupt index.
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), "index"), []byte("bad"), 0o600))
+	_, err := store.RetrieveAccountsIndex(walletID)
+	require.Error(t, err)
+
+	require.NoError(t, store.RebuildAccountsIndex(walletID))
+	index := retrieveIndex(t, store, walletID)
+	for accountID, accountName := range accounts {
+		name, exists := index.Name(accountID)
+		require.True(t, exists)
+		require.Equal(t, accountName, name)
+	}
+
+	// Files that are not accounts are ignored.
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), "notes.txt~"), []byte("notes"), 0o600))
+	require.NoError(t, store.RebuildAccountsIndex(walletID))
+	require.Equal(t, index, retrieveIndex(t, store, walletID))
+
+	// An account that cannot be read is reported, and left out of the index.
+	var badAccountID uuid.UUID
+	for accountID := range accounts {
+		badAccountID = accountID
+		break
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), badAccountID.String()), []byte("bad"), 0o600))
+	err = store.RebuildAccountsIndex(walletID)
+	var unreadable *filesystem.UnreadableAccountsError
+	require.True(t, errors.As(err, &unreadable))
+	require.Equal(t, []uuid.UUID{badAccountID}, unreadable.IDs)
+	require.ErrorContains(t, err, badAccountID.String())
+	index = retrieveIndex(t, store, walletID)
+	require.False(t, index.IDKnown(badAccountID))
+	for accountID, accountName := range accounts {
+		if accountID == badAccountID {
+			continue
+		}
+		name, exists := index.Name(accountID)
+		require.True(t, exists)
+		require.Equal(t, accountName, name)
+	}
+}
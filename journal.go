@@ -0,0 +1,192 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// journalStagePrefix is the prefix for files staged to be committed together.
+const journalStagePrefix = ".journal-"
+
+// walletJournal records changes to files in a wallet that are committed
+// together.  Files are recorded relative to the wallet's directory.
+type walletJournal struct {
+	// Files are the files that are replaced by their staged versions.
+	Files []string `json:"files,omitempty"`
+	// Removed are the files that are removed.
+	Removed []string `json:"removed,omitempty"`
+}
+
+// walletChange is a change to a file in a wallet.  A file with nil data is removed.
+type walletChange struct {
+	path string
+	data []byte
+}
+
+// commitWalletChanges makes changes to files in a wallet together.  New
+// versions of the files are staged alongside the originals, then the journal
+// is written, and then the staged files replace the originals.  If this is
+// interrupted before the journal is written the wallet is unchanged, and if
+// it is interrupted afterwards it is completed when the wallet is next locked.
+// The caller must hold an exclusive lock on the wallet.
+func (s *Store) commitWalletChanges(walletID uuid.UUID, changes []*walletChange) error {
+	if err := s.removeStagedFiles(walletID); err != nil {
+		return err
+	}
+
+	journal := &walletJournal{}
+	for _, change := range changes {
+		name, err := filepath.Rel(s.walletPath(walletID), change.path)
+		if err != nil {
+			return errors.Wrap(err, "failed to obtain relative path")
+		}
+		if change.data == nil {
+			journal.Removed = append(journal.Removed, filepath.ToSlash(name))
+			continue
+		}
+		if err := writeFile(journalStagePath(change.path), change.data, 0o600); err != nil {
+			return errors.Wrapf(err, "failed to stage %s", change.path)
+		}
+		journal.Files = append(journal.Files, filepath.ToSlash(name))
+	}
+
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal wallet journal")
+	}
+	if err := writeFile(s.walletJournalPath(walletID), data, 0o600); err != nil {
+		return errors.Wrap(err, "failed to write wallet journal")
+	}
+
+	return s.completeWalletJournal(walletID, journal)
+}
+
+// completeWalletJournal makes the changes recorded in the wallet's journal,
+// and removes the journal.  The caller must hold an exclusive lock on the wallet.
+func (s *Store) completeWalletJournal(walletID uuid.UUID, journal *walletJournal) error {
+	walletPath := s.walletPath(walletID)
+	for _, name := range journal.Files {
+		path := filepath.Join(walletPath, filepath.FromSlash(name))
+		err := os.Rename(journalStagePath(path), path)
+		if err != nil && !os.IsNotExist(err) {
+			// Not existing means that the file has already been committed.
+			return errors.Wrapf(err, "failed to commit %s", path)
+		}
+	}
+	for _, name := range journal.Removed {
+		path := filepath.Join(walletPath, filepath.FromSlash(name))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to remove %s", path)
+		}
+	}
+	if err := syncDir(walletPath); err != nil {
+		return err
+	}
+
+	if err := removeFile(s.walletJournalPath(walletID)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove wallet journal")
+	}
+
+	return nil
+}
+
+// recoverWalletJournal completes changes to a wallet that were interrupted
+// after its journal was written, or removes the files staged by changes that
+// were interrupted before it was written.  The caller must hold an exclusive
+// lock on the wallet, or on the store.
+func (s *Store) recoverWalletJournal(walletID uuid.UUID) error {
+	data, err := os.ReadFile(s.walletJournalPath(walletID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s.removeStagedFiles(walletID)
+		}
+		return errors.Wrap(err, "failed to read wallet journal")
+	}
+	journal := &walletJournal{}
+	if err := json.Unmarshal(data, journal); err != nil {
+		return errors.Wrap(err, "failed to parse wallet journal")
+	}
+
+	return s.completeWalletJournal(walletID, journal)
+}
+
+// removeStagedFiles removes files staged for changes to a wallet that were
+// interrupted before its journal was written, and so were never committed.
+// The caller must hold an exclusive lock on the wallet, or on the store, and
+// the wallet must not have a journal.
+func (s *Store) removeStagedFiles(walletID uuid.UUID) error {
+	entries, err := os.ReadDir(s.walletPath(walletID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to read wallet directory")
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), journalStagePrefix) {
+			continue
+		}
+		path := filepath.Join(s.walletPath(walletID), entry.Name())
+		if err := removeFile(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to remove staged file %s", path)
+		}
+	}
+
+	return nil
+}
+
+// recoverWalletJournals completes interrupted changes to all wallets.
+// The caller must hold an exclusive lock on the store.
+func (s *Store) recoverWalletJournals() error {
+	return s.walkStoreDirs(func(dir string, _ []os.DirEntry) error {
+		walletID, err := uuid.Parse(filepath.Base(dir))
+		if err != nil {
+			// Not a wallet.
+			return nil
+		}
+		return s.recoverWalletJournal(walletID)
+	})
+}
+
+// ensureWalletJournalRecovered ensures that any interrupted changes to a
+// wallet have been completed before the wallet is used.  The caller must hold
+// a store-level lock.
+func (s *Store) ensureWalletJournalRecovered(walletID uuid.UUID) error {
+	if _, err := os.Stat(s.walletJournalPath(walletID)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to check for wallet journal")
+	}
+
+	lock, err := s.acquireLock(s.walletLockPath(walletID), true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock wallet for recovery")
+	}
+	defer lock.unlock()
+
+	return s.recoverWalletJournal(walletID)
+}
+
+// journalStagePath returns the path at which the new version of a file is staged.
+func journalStagePath(path string) string {
+	return filepath.Join(filepath.Dir(path), journalStagePrefix+filepath.Base(path))
+}
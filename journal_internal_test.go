@@ -0,0 +1,110 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/go-indexer"
+)
+
+// stageAccountWithIndex stages an account along with an accounts index
+// holding it, as the first step of a managed write.
+func stageAccountWithIndex(t *testing.T, store *Store, walletID uuid.UUID, accountID uuid.UUID, accountData []byte) *walletJournal {
+	t.Helper()
+
+	data, err := store.encryptIfRequired(accountBinding(walletID, accountID), accountData)
+	require.NoError(t, err)
+	require.NoError(t, writeFile(journalStagePath(store.accountPath(walletID, accountID)), data, 0o600))
+	index := indexer.New()
+	index.Add(accountID, "test account")
+	data, err = store.encodeAccountsIndex(walletID, index)
+	require.NoError(t, err)
+	require.NoError(t, writeFile(journalStagePath(store.walletIndexPath(walletID)), data, 0o600))
+
+	return &walletJournal{Files: []string{accountID.String(), "index"}}
+}
+
+// requireNoStagedFiles requires that the wallet does not contain any staged files.
+func requireNoStagedFiles(t *testing.T, store *Store, walletID uuid.UUID) {
+	t.Helper()
+
+	entries, err := os.ReadDir(store.walletPath(walletID))
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.False(t, strings.HasPrefix(entry.Name(), journalStagePrefix), entry.Name())
+	}
+}
+
+func TestWalletJournalInterrupted(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := New(WithLocation(path), WithPassphrase([]byte("test")), WithManagedAccountsIndex(true)).(*Store)
+
+	walletID := uuid.New()
+	walletData := []byte(fmt.Sprintf(`{"name":"test wallet","uuid":%q}`, walletID))
+	require.NoError(t, store.StoreWallet(walletID, "test wallet", walletData))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID))
+
+	// Interrupted before the journal is written: the wallet is unchanged.
+	stageAccountWithIndex(t, store, walletID, accountID, accountData)
+	_, err := store.RetrieveAccount(walletID, accountID)
+	require.True(t, errors.Is(err, ErrAccountNotFound))
+	_, err = store.RetrieveAccountsIndex(walletID)
+	require.True(t, errors.Is(err, ErrIndexNotFound))
+	// The staged files are removed on recovery.
+	require.NoError(t, store.recoverWalletJournals())
+	requireNoStagedFiles(t, store, walletID)
+
+	// Interrupted before the journal is written again: the staged files are
+	// removed by the next change.
+	stageAccountWithIndex(t, store, walletID, accountID, accountData)
+	otherAccountID := uuid.New()
+	otherAccountData := []byte(fmt.Sprintf(`{"name":"other account","uuid":%q}`, otherAccountID))
+	require.NoError(t, store.StoreAccount(walletID, otherAccountID, otherAccountData))
+	requireNoStagedFiles(t, store, walletID)
+	_, err = store.RetrieveAccount(walletID, accountID)
+	require.True(t, errors.Is(err, ErrAccountNotFound))
+	require.NoError(t, store.DeleteAccount(walletID, otherAccountID))
+
+	// Interrupted after the journal is written and a single file committed:
+	// the change is completed when the wallet is next used.
+	journal := stageAccountWithIndex(t, store, walletID, accountID, accountData)
+	data, err := json.Marshal(journal)
+	require.NoError(t, err)
+	require.NoError(t, writeFile(store.walletJournalPath(walletID), data, 0o600))
+	require.NoError(t, os.Rename(journalStagePath(store.accountPath(walletID, accountID)), store.accountPath(walletID, accountID)))
+
+	newStore := New(WithLocation(path), WithPassphrase([]byte("test"))).(*Store)
+	data, err = newStore.RetrieveAccountsIndex(walletID)
+	require.NoError(t, err)
+	index, err := indexer.Deserialize(data)
+	require.NoError(t, err)
+	require.True(t, index.IDKnown(accountID))
+	data, err = newStore.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, data)
+	_, err = os.Stat(store.walletJournalPath(walletID))
+	require.True(t, os.IsNotExist(err))
+}
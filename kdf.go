@@ -0,0 +1,352 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"runtime"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key derivation functions with which keys can be derived from a passphrase.
+const (
+	// KDFPBKDF2SHA256 is PBKDF2 with HMAC-SHA256.
+	KDFPBKDF2SHA256 = "pbkdf2-sha256"
+	// KDFScrypt is scrypt.
+	KDFScrypt = "scrypt"
+	// KDFArgon2id is Argon2id.
+	KDFArgon2id = "argon2id"
+)
+
+// Lengths of the encoded parameters of key derivation functions.
+const (
+	pbkdf2ParamsLen   = 4
+	scryptParamsLen   = 9
+	argon2idParamsLen = 9
+)
+
+// Upper bounds on the parameters of key derivation functions.  Parameters are
+// read from files in the store, so they are bounded to stop a crafted file
+// from exhausting the memory or CPU of the process that reads it.
+const (
+	maxKDFMemory          = 4 << 30
+	maxPBKDF2Iterations   = 1 << 25
+	maxScryptN            = 1 << 24
+	maxScryptR            = 64
+	maxScryptP            = 64
+	maxScryptWork         = 1 << 26
+	maxArgon2idIterations = 1 << 10
+	maxArgon2idThreads    = 64
+	maxArgon2idWork       = 1 << 26
+)
+
+// KDFParams are a key derivation function and its cost parameters.
+type KDFParams struct {
+	// Algorithm is the key derivation function.
+	Algorithm string `json:"kdf"`
+	// Iterations is the number of iterations for PBKDF2, or the number of passes for Argon2id.
+	Iterations uint32 `json:"iterations,omitempty"`
+	// Memory is the memory in KiB used by Argon2id.
+	Memory uint32 `json:"memory,omitempty"`
+	// Threads is the number of threads used by Argon2id.
+	Threads uint8 `json:"threads,omitempty"`
+	// N is the CPU and memory cost for scrypt, which must be a power of two.
+	N uint64 `json:"n,omitempty"`
+	// R is the block size for scrypt.
+	R uint32 `json:"r,omitempty"`
+	// P is the parallelisation for scrypt.
+	P uint32 `json:"p,omitempty"`
+}
+
+// defaultKDFParams are the parameters used if none are supplied, which are
+// those used by go-ecodec.
+var defaultKDFParams = &KDFParams{
+	Algorithm:  KDFPBKDF2SHA256,
+	Iterations: ecodecPBKDF2Iterations,
+}
+
+// WithKDF sets the key derivation function with which keys are derived from
+// the passphrase, or the secrets for key slots.  If this is not set a store
+// opened with Open uses the function recorded in its metadata, and otherwise
+// PBKDF2 with the same parameters as go-ecodec.  Data is readable regardless
+// of the function with which it was written.
+func WithKDF(params *KDFParams) Option {
+	return optionFunc(func(o *options) {
+		o.kdf = params
+	})
+}
+
+// kdfParamsOrDefault returns the parameters, or the default parameters if they are nil.
+func kdfParamsOrDefault(params *KDFParams) *KDFParams {
+	if params == nil {
+		return defaultKDFParams
+	}
+
+	return params
+}
+
+// isDefault returns true if the parameters are the default parameters.
+func (p *KDFParams) isDefault() bool {
+	return *p == *defaultKDFParams
+}
+
+// validate checks that the parameters are usable, and within the bounds that
+// limit the memory and CPU used to derive a key.
+func (p *KDFParams) validate() error {
+	switch p.Algorithm {
+	case KDFPBKDF2SHA256:
+		if p.Iterations == 0 {
+			return errors.New("PBKDF2 iterations must be at least 1")
+		}
+		if p.Iterations > maxPBKDF2Iterations {
+			return fmt.Errorf("PBKDF2 iterations must be at most %d", maxPBKDF2Iterations)
+		}
+	case KDFScrypt:
+		if p.N < 2 || p.N&(p.N-1) != 0 {
+			return errors.New("scrypt N must be a power of two greater than 1")
+		}
+		if p.N > maxScryptN {
+			return fmt.Errorf("scrypt N must be at most %d", maxScryptN)
+		}
+		if p.R == 0 || p.P == 0 {
+			return errors.New("scrypt r and p must be at least 1")
+		}
+		if p.R > maxScryptR || p.P > maxScryptP {
+			return fmt.Errorf("scrypt r and p must be at most %d and %d", maxScryptR, maxScryptP)
+		}
+		// Bounded above, so these cannot overflow.
+		if 128*p.N*uint64(p.R) > maxKDFMemory {
+			return fmt.Errorf("scrypt N and r require more than %d bytes of memory", maxKDFMemory)
+		}
+		if p.N*uint64(p.R)*uint64(p.P) > maxScryptWork {
+			return errors.New("scrypt N, r and p are too large")
+		}
+	case KDFArgon2id:
+		if p.Iterations == 0 {
+			return errors.New("Argon2id iterations must be at least 1")
+		}
+		if p.Iterations > maxArgon2idIterations {
+			return fmt.Errorf("Argon2id iterations must be at most %d", maxArgon2idIterations)
+		}
+		if p.Threads == 0 {
+			return errors.New("Argon2id threads must be at least 1")
+		}
+		if p.Threads > maxArgon2idThreads {
+			return fmt.Errorf("Argon2id threads must be at most %d", maxArgon2idThreads)
+		}
+		if p.Memory < 8*uint32(p.Threads) {
+			return errors.New("Argon2id memory must be at least 8KiB per thread")
+		}
+		if uint64(p.Memory)*1024 > maxKDFMemory {
+			return fmt.Errorf("Argon2id memory must be at most %dKiB", maxKDFMemory/1024)
+		}
+		if uint64(p.Memory)*uint64(p.Iterations) > maxArgon2idWork {
+			return errors.New("Argon2id memory and iterations are too large")
+		}
+	default:
+		return fmt.Errorf("unsupported key derivation function %q", p.Algorithm)
+	}
+
+	return nil
+}
+
+// deriveKey derives a key from the passphrase with the given salt.
+func (p *KDFParams) deriveKey(passphrase []byte, salt []byte) ([]byte, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	switch p.Algorithm {
+	case KDFScrypt:
+		return scrypt.Key(passphrase, salt, int(p.N), int(p.R), int(p.P), ecodecKeyLen)
+	case KDFArgon2id:
+		return argon2.IDKey(passphrase, salt, p.Iterations, p.Memory, p.Threads, ecodecKeyLen), nil
+	default:
+		return pbkdf2.Key(passphrase, salt, int(p.Iterations), ecodecKeyLen, sha256.New), nil
+	}
+}
+
+// envelopeKDF returns the envelope's identifier for the key derivation function.
+// PBKDF2 with the default parameters has its own identifier, as its
+// parameters are not recorded in the envelope.
+func (p *KDFParams) envelopeKDF() byte {
+	switch {
+	case p.isDefault():
+		return envelopeKDFPBKDF2SHA256
+	case p.Algorithm == KDFScrypt:
+		return envelopeKDFScrypt
+	case p.Algorithm == KDFArgon2id:
+		return envelopeKDFArgon2id
+	default:
+		return envelopeKDFPBKDF2SHA256Params
+	}
+}
+
+// encode encodes the parameters for the envelope's payload.
+func (p *KDFParams) encode() []byte {
+	var res []byte
+	switch p.envelopeKDF() {
+	case envelopeKDFPBKDF2SHA256Params:
+		res = binary.BigEndian.AppendUint32(res, p.Iterations)
+	case envelopeKDFScrypt:
+		res = append(res, byte(bits.TrailingZeros64(p.N)))
+		res = binary.BigEndian.AppendUint32(res, p.R)
+		res = binary.BigEndian.AppendUint32(res, p.P)
+	case envelopeKDFArgon2id:
+		res = binary.BigEndian.AppendUint32(res, p.Iterations)
+		res = binary.BigEndian.AppendUint32(res, p.Memory)
+		res = append(res, p.Threads)
+	}
+
+	return res
+}
+
+// decodeKDFParams decodes the parameters for the envelope's key derivation
+// function from the start of the payload, returning them along with the
+// remainder of the payload.
+func decodeKDFParams(kdf byte, payload []byte) (*KDFParams, []byte, error) {
+	var params *KDFParams
+	var paramsLen int
+	switch kdf {
+	case envelopeKDFPBKDF2SHA256:
+		return defaultKDFParams, payload, nil
+	case envelopeKDFPBKDF2SHA256Params:
+		paramsLen = pbkdf2ParamsLen
+		if len(payload) < paramsLen {
+			break
+		}
+		params = &KDFParams{
+			Algorithm:  KDFPBKDF2SHA256,
+			Iterations: binary.BigEndian.Uint32(payload),
+		}
+	case envelopeKDFScrypt:
+		paramsLen = scryptParamsLen
+		if len(payload) < paramsLen {
+			break
+		}
+		if payload[0] > byte(bits.TrailingZeros64(maxScryptN)) {
+			return nil, nil, fmt.Errorf("scrypt N must be at most %d", maxScryptN)
+		}
+		params = &KDFParams{
+			Algorithm: KDFScrypt,
+			N:         1 << payload[0],
+			R:         binary.BigEndian.Uint32(payload[1:]),
+			P:         binary.BigEndian.Uint32(payload[5:]),
+		}
+	case envelopeKDFArgon2id:
+		paramsLen = argon2idParamsLen
+		if len(payload) < paramsLen {
+			break
+		}
+		params = &KDFParams{
+			Algorithm:  KDFArgon2id,
+			Iterations: binary.BigEndian.Uint32(payload),
+			Memory:     binary.BigEndian.Uint32(payload[4:]),
+			Threads:    payload[8],
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported key derivation function %d", kdf)
+	}
+	if params == nil {
+		return nil, nil, errors.New("key derivation parameters too short")
+	}
+	if err := params.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return params, payload[paramsLen:], nil
+}
+
+// Minimum parameters considered by CalibrateKDF.
+const (
+	calibrationPBKDF2Iterations = 100000
+	calibrationScryptLogN       = 15
+	calibrationScryptMaxLogN    = 22
+	calibrationArgon2idMemory   = 64 * 1024
+)
+
+// CalibrateKDF returns parameters for the given key derivation function that
+// take approximately the target time to derive a key on this machine.  The
+// parameters are never weaker than a sensible minimum, so may take longer
+// than the target on slow machines.
+// For scrypt the memory used grows along with the time, so the parameters are
+// limited to 4GiB of memory.  For Argon2id 64MiB of memory is used and the
+// number of passes is calibrated.  Parameters never exceed the bounds that
+// the store accepts when reading data.
+func CalibrateKDF(algorithm string, target time.Duration) (*KDFParams, error) {
+	var params *KDFParams
+	switch algorithm {
+	case KDFPBKDF2SHA256:
+		params = &KDFParams{
+			Algorithm:  KDFPBKDF2SHA256,
+			Iterations: calibrationPBKDF2Iterations,
+		}
+	case KDFScrypt:
+		params = &KDFParams{
+			Algorithm: KDFScrypt,
+			N:         1 << calibrationScryptLogN,
+			R:         8,
+			P:         1,
+		}
+	case KDFArgon2id:
+		threads := runtime.NumCPU()
+		if threads > 4 {
+			threads = 4
+		}
+		params = &KDFParams{
+			Algorithm:  KDFArgon2id,
+			Iterations: 1,
+			Memory:     calibrationArgon2idMemory,
+			Threads:    uint8(threads),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key derivation function %q", algorithm)
+	}
+
+	started := time.Now()
+	key, err := params.deriveKey([]byte("calibration"), make([]byte, ecodecSaltLen))
+	if err != nil {
+		return nil, err
+	}
+	zero(key)
+	elapsed := time.Since(started)
+
+	// Cost is linear in the calibrated parameter.
+	scale := float64(target) / float64(elapsed)
+	if scale <= 1 {
+		return params, nil
+	}
+	switch algorithm {
+	case KDFPBKDF2SHA256:
+		params.Iterations = uint32(math.Min(float64(params.Iterations)*scale, maxPBKDF2Iterations))
+	case KDFScrypt:
+		logN := calibrationScryptLogN + int(math.Round(math.Log2(scale)))
+		if logN > calibrationScryptMaxLogN {
+			logN = calibrationScryptMaxLogN
+		}
+		params.N = 1 << logN
+	case KDFArgon2id:
+		params.Iterations = uint32(math.Min(math.Round(float64(params.Iterations)*scale), maxArgon2idWork/calibrationArgon2idMemory))
+	}
+
+	return params, nil
+}
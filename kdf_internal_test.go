@@ -0,0 +1,95 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKDFParamsEncoding(t *testing.T) {
+	for _, params := range []*KDFParams{
+		defaultKDFParams,
+		{Algorithm: KDFPBKDF2SHA256, Iterations: 1000},
+		{Algorithm: KDFScrypt, N: 1 << 20, R: 8, P: 2},
+		{Algorithm: KDFArgon2id, Iterations: 3, Memory: 65536, Threads: 4},
+	} {
+		payload := append(params.encode(), 0x01, 0x02)
+		decoded, rest, err := decodeKDFParams(params.envelopeKDF(), payload)
+		require.NoError(t, err)
+		require.Equal(t, params, decoded)
+		require.Equal(t, []byte{0x01, 0x02}, rest)
+
+		if encoded := params.encode(); len(encoded) > 0 {
+			_, _, err = decodeKDFParams(params.envelopeKDF(), encoded[:len(encoded)-1])
+			require.EqualError(t, err, "key derivation parameters too short")
+		}
+	}
+
+	_, _, err := decodeKDFParams(envelopeKDFNone, nil)
+	require.EqualError(t, err, "unsupported key derivation function 0")
+}
+
+func TestKDFParamsBounds(t *testing.T) {
+	for _, params := range []*KDFParams{
+		{Algorithm: KDFPBKDF2SHA256, Iterations: maxPBKDF2Iterations + 1},
+		{Algorithm: KDFScrypt, N: maxScryptN << 1, R: 1, P: 1},
+		{Algorithm: KDFScrypt, N: 1 << 10, R: maxScryptR + 1, P: 1},
+		{Algorithm: KDFScrypt, N: 1 << 10, R: 8, P: maxScryptP + 1},
+		{Algorithm: KDFScrypt, N: maxScryptN, R: 8, P: 1},
+		{Algorithm: KDFScrypt, N: 1 << 22, R: 8, P: 16},
+		{Algorithm: KDFArgon2id, Iterations: maxArgon2idIterations + 1, Memory: 1024, Threads: 1},
+		{Algorithm: KDFArgon2id, Iterations: 1, Memory: 1024, Threads: maxArgon2idThreads + 1},
+		{Algorithm: KDFArgon2id, Iterations: 1, Memory: maxKDFMemory/1024 + 1, Threads: 1},
+		{Algorithm: KDFArgon2id, Iterations: 64, Memory: 4 << 20, Threads: 1},
+	} {
+		require.Error(t, params.validate(), "%+v", params)
+	}
+}
+
+func TestCraftedKDFParams(t *testing.T) {
+	store, walletID, accounts := setupRekeyTest(t, []byte("test"))
+
+	// An account with scrypt parameters that would require far more memory
+	// than is available.
+	params := binary.BigEndian.AppendUint32([]byte{40}, 8)
+	params = binary.BigEndian.AppendUint32(params, 1)
+	payload := append(params, make([]byte, 64)...)
+	data := sealEnvelope(&envelope{kind: envelopeEncrypted, cipher: envelopeCipherAES256GCM, kdf: envelopeKDFScrypt, payload: payload})
+	craftedID := uuid.New()
+	require.NoError(t, os.WriteFile(store.accountPath(walletID, craftedID), data, 0o600))
+
+	_, err := store.RetrieveAccount(walletID, craftedID)
+	require.True(t, errors.Is(err, ErrDecryptionFailed))
+	require.ErrorContains(t, err, "scrypt N must be at most 16777216")
+
+	// Other accounts remain readable.
+	retrieved := 0
+	failed := 0
+	for res := range store.RetrieveAccountResults(walletID) {
+		if res.Err != nil {
+			require.ErrorContains(t, res.Err, "scrypt N must be at most")
+			failed++
+			continue
+		}
+		retrieved++
+	}
+	require.Equal(t, len(accounts), retrieved)
+	require.Equal(t, 1, failed)
+}
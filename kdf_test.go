@@ -0,0 +1,201 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+func TestKDFs(t *testing.T) {
+	tests := []struct {
+		name   string
+		params *filesystem.KDFParams
+		kdf    byte
+	}{
+		{
+			name:   "PBKDF2",
+			params: &filesystem.KDFParams{Algorithm: filesystem.KDFPBKDF2SHA256, Iterations: 1000},
+			kdf:    2,
+		},
+		{
+			name:   "Scrypt",
+			params: &filesystem.KDFParams{Algorithm: filesystem.KDFScrypt, N: 1024, R: 8, P: 1},
+			kdf:    3,
+		},
+		{
+			name:   "Argon2id",
+			params: &filesystem.KDFParams{Algorithm: filesystem.KDFArgon2id, Iterations: 1, Memory: 1024, Threads: 1},
+			kdf:    4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+			defer os.RemoveAll(path)
+			passphrase := []byte("test")
+
+			store, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithCreate(true), filesystem.WithPassphrase(passphrase), filesystem.WithKDF(test.params))
+			require.NoError(t, err)
+			walletID := uuid.New()
+			walletName := "test wallet"
+			walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+			require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+			accountID := uuid.New()
+			accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+			require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+
+			// The function is recorded in the metadata and in the header of each file.
+			metadata, err := os.ReadFile(filepath.Join(path, "store.json"))
+			require.NoError(t, err)
+			require.True(t, bytes.Contains(metadata, []byte(fmt.Sprintf(`"kdf":%q`, test.params.Algorithm))))
+			raw, err := os.ReadFile(filepath.Join(path, walletID.String(), accountID.String()))
+			require.NoError(t, err)
+			require.Equal(t, test.kdf, raw[7])
+
+			// The store is readable without supplying the function.
+			store, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+			require.NoError(t, err)
+			data, err := store.RetrieveAccount(walletID, accountID)
+			require.NoError(t, err)
+			require.Equal(t, accountData, data)
+			data, err = filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase)).RetrieveWallet(walletName)
+			require.NoError(t, err)
+			require.Equal(t, walletData, data)
+
+			_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("wrong")))
+			require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+		})
+	}
+}
+
+func TestChangeKDF(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+	newPassphrase := []byte("new passphrase")
+
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+
+	// Changing the passphrase re-encrypts data with the supplied function.
+	params := &filesystem.KDFParams{Algorithm: filesystem.KDFArgon2id, Iterations: 1, Memory: 1024, Threads: 1}
+	opened, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase), filesystem.WithKDF(params))
+	require.NoError(t, err)
+	require.NoError(t, opened.ChangePassphrase(passphrase, newPassphrase))
+	raw, err := os.ReadFile(filepath.Join(path, walletID.String(), walletID.String()))
+	require.NoError(t, err)
+	require.Equal(t, byte(4), raw[7])
+
+	opened, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(newPassphrase))
+	require.NoError(t, err)
+	data, err := opened.RetrieveWallet(walletName)
+	require.NoError(t, err)
+	require.Equal(t, walletData, data)
+}
+
+func TestKDFKeySlots(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+	params := &filesystem.KDFParams{Algorithm: filesystem.KDFScrypt, N: 1024, R: 8, P: 1}
+
+	store, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithCreate(true), filesystem.WithKeySlotPassphrase(passphrase), filesystem.WithKDF(params))
+	require.NoError(t, err)
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+
+	slots, err := os.ReadFile(filepath.Join(path, "keyslots.json"))
+	require.NoError(t, err)
+	require.True(t, bytes.Contains(slots, []byte(`"kdf":"scrypt"`)))
+
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithKeySlotPassphrase(passphrase))
+	require.NoError(t, err)
+}
+
+func TestInvalidKDF(t *testing.T) {
+	tests := []struct {
+		name   string
+		params *filesystem.KDFParams
+		err    string
+	}{
+		{
+			name:   "Unknown",
+			params: &filesystem.KDFParams{Algorithm: "unknown"},
+			err:    `unsupported key derivation function "unknown"`,
+		},
+		{
+			name:   "PBKDF2NoIterations",
+			params: &filesystem.KDFParams{Algorithm: filesystem.KDFPBKDF2SHA256},
+			err:    "PBKDF2 iterations must be at least 1",
+		},
+		{
+			name:   "ScryptBadN",
+			params: &filesystem.KDFParams{Algorithm: filesystem.KDFScrypt, N: 1000, R: 8, P: 1},
+			err:    "scrypt N must be a power of two greater than 1",
+		},
+		{
+			name:   "Argon2idLowMemory",
+			params: &filesystem.KDFParams{Algorithm: filesystem.KDFArgon2id, Iterations: 1, Memory: 8, Threads: 4},
+			err:    "Argon2id memory must be at least 8KiB per thread",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := filesystem.Open(filesystem.WithLocation(os.TempDir()), filesystem.WithPassphrase([]byte("test")), filesystem.WithKDF(test.params))
+			require.EqualError(t, err, test.err)
+		})
+	}
+}
+
+func TestCalibrateKDF(t *testing.T) {
+	// A short target returns the minimum parameters.
+	params, err := filesystem.CalibrateKDF(filesystem.KDFPBKDF2SHA256, time.Nanosecond)
+	require.NoError(t, err)
+	require.Equal(t, &filesystem.KDFParams{Algorithm: filesystem.KDFPBKDF2SHA256, Iterations: 100000}, params)
+
+	params, err = filesystem.CalibrateKDF(filesystem.KDFScrypt, time.Nanosecond)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1<<15), params.N)
+
+	params, err = filesystem.CalibrateKDF(filesystem.KDFArgon2id, time.Nanosecond)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), params.Iterations)
+	require.Equal(t, uint32(64*1024), params.Memory)
+
+	// A longer target scales the parameters.
+	params, err = filesystem.CalibrateKDF(filesystem.KDFPBKDF2SHA256, time.Second)
+	require.NoError(t, err)
+	require.Greater(t, params.Iterations, uint32(100000))
+
+	_, err = filesystem.CalibrateKDF("unknown", time.Second)
+	require.EqualError(t, err, `unsupported key derivation function "unknown"`)
+}
@@ -0,0 +1,194 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"crypto/rand"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// maxCachedKeys is the maximum number of derived keys held by a key cache.
+// Data written by this store shares a single salt, however data written by
+// other stores or older versions of this module has a salt per file.
+const maxCachedKeys = 1024
+
+// keyIndex identifies a derived key by the parameters and salt with which it was derived.
+type keyIndex struct {
+	params KDFParams
+	salt   [ecodecSaltLen]byte
+}
+
+// keyCache caches keys derived from a passphrase, to avoid running the key
+// derivation function for every file that is encrypted or decrypted.
+type keyCache struct {
+	passphrase []byte
+	kdf        *KDFParams
+	// passphraseFunc supplies the passphrase if it is not yet known.
+	passphraseFunc func() ([]byte, error)
+	mutex          sync.Mutex
+	salt           []byte
+	keys           map[keyIndex][]byte
+	order          []keyIndex
+	// retired is set once the cache has been replaced, after which keys are
+	// no longer cached.
+	retired bool
+}
+
+// newKeyCache creates a new key cache for the given passphrase.  Keys for
+// encryption are derived with the given parameters, or the default parameters
+// if they are nil.
+func newKeyCache(passphrase []byte, kdf *KDFParams) *keyCache {
+	return &keyCache{
+		passphrase: passphrase,
+		kdf:        kdfParamsOrDefault(kdf),
+		keys:       make(map[keyIndex][]byte),
+	}
+}
+
+// encryptionKey returns the salt and derived key to use when encrypting data.
+// The salt is generated once for the life of the cache.
+func (c *keyCache) encryptionKey() ([]byte, []byte, error) {
+	c.mutex.Lock()
+	if c.salt == nil {
+		salt := make([]byte, ecodecSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			c.mutex.Unlock()
+			return nil, nil, err
+		}
+		c.salt = salt
+	}
+	salt := c.salt
+	c.mutex.Unlock()
+
+	key, err := c.key(c.kdf, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return salt, key, nil
+}
+
+// key returns the key derived from the passphrase with the given parameters
+// and salt.  The returned key is a copy, which the caller should zero once it
+// is no longer required.
+func (c *keyCache) key(kdf *KDFParams, salt []byte) ([]byte, error) {
+	index := keyIndex{params: *kdf}
+	copy(index.salt[:], salt)
+
+	c.mutex.Lock()
+	key, exists := c.keys[index]
+	c.mutex.Unlock()
+	if exists {
+		return copyBytes(key), nil
+	}
+
+	passphrase, err := c.secret()
+	if err != nil {
+		return nil, err
+	}
+	// Derive the key outside of the lock, as it is expensive.
+	key, err = kdf.deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.retired {
+		// Operations still in progress may derive keys, but they are not kept.
+		return key, nil
+	}
+	if existing, exists := c.keys[index]; exists {
+		// Derived concurrently.
+		zero(key)
+		return copyBytes(existing), nil
+	}
+	if len(c.order) >= maxCachedKeys {
+		// Evict the oldest key, leaving the key used for encryption in place.
+		for i, oldest := range c.order {
+			if c.salt != nil && oldest.salt == [ecodecSaltLen]byte(c.salt) && oldest.params == *c.kdf {
+				continue
+			}
+			zero(c.keys[oldest])
+			delete(c.keys, oldest)
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	c.keys[index] = key
+	c.order = append(c.order, index)
+
+	return copyBytes(key), nil
+}
+
+// secret returns the passphrase, obtaining it from the passphrase function
+// if it is not yet known.
+func (c *keyCache) secret() ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.passphrase) == 0 && c.passphraseFunc != nil {
+		passphrase, err := c.passphraseFunc()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to obtain passphrase")
+		}
+		if len(passphrase) == 0 {
+			return nil, errors.New("failed to obtain passphrase: passphrase is empty")
+		}
+		c.passphrase = passphrase
+	}
+
+	return c.passphrase, nil
+}
+
+// clear removes all keys from the cache, zeroing them in memory.
+func (c *keyCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for index, key := range c.keys {
+		zero(key)
+		delete(c.keys, index)
+	}
+	c.order = nil
+	c.salt = nil
+}
+
+// retire clears the cache and stops it from caching keys, for a cache that
+// has been replaced but may still be in use by operations in progress.
+// Keys held by those operations are copies, which they zero once finished.
+func (c *keyCache) retire() {
+	c.clear()
+
+	c.mutex.Lock()
+	c.retired = true
+	c.mutex.Unlock()
+}
+
+// copyBytes returns a copy of a byte slice.
+func copyBytes(data []byte) []byte {
+	res := make([]byte, len(data))
+	copy(res, data)
+
+	return res
+}
+
+// zero overwrites the contents of a byte slice.
+func zero(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/wealdtech/go-ecodec"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// envelopeHeaderLen is the length of the envelope in which the store holds data.
+const envelopeHeaderLen = 12
+
+func TestEcodecCompatibility(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+
+	// The canary written by the store can be read by ecodec.
+	metadataData, err := os.ReadFile(filepath.Join(path, "store.json"))
+	require.NoError(t, err)
+	metadata := &struct {
+		Encryption struct {
+			Canary string `json:"canary"`
+		} `json:"encryption"`
+	}{}
+	require.NoError(t, json.Unmarshal(metadataData, metadata))
+	canary, err := hex.DecodeString(metadata.Encryption.Canary)
+	require.NoError(t, err)
+	decryptedCanary, err := ecodec.Decrypt(canary, passphrase)
+	require.NoError(t, err)
+	require.Equal(t, []byte("go-eth2-wallet-store-filesystem canary"), decryptedCanary)
+
+	// Data written by ecodec, as by older versions of the store, can be read by the store.
+	// Such data is only found in stores written by older versions, which did not write metadata.
+	require.NoError(t, os.Remove(filepath.Join(path, "store.json")))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	encryptedAccountData, err := ecodec.Encrypt(accountData, passphrase)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), accountID.String()), encryptedAccountData, 0o600))
+	retrievedAccountData, err := store.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, retrievedAccountData)
+}
+
+// BenchmarkRetrieveAccounts compares retrieving the accounts of an encrypted wallet
+// with a key derived once per store against deriving a key for every account, as
+// was done previously.
+// The uncached benchmark runs the key derivation function once per account,
+// which takes minutes for 10,000 accounts, so it is skipped for that number of
+// accounts if -short is set.
+func BenchmarkRetrieveAccounts(b *testing.B) {
+	for _, accounts := range []int{10, 100, 10000} {
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", b.Name(), rand.Int31()))
+		defer os.RemoveAll(path)
+		passphrase := []byte("test")
+		store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+
+		walletID := uuid.New()
+		walletName := "test wallet"
+		walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+		require.NoError(b, store.StoreWallet(walletID, walletName, walletData))
+		for i := 0; i < accounts; i++ {
+			accountID := uuid.New()
+			accountData := []byte(fmt.Sprintf(`{"name":"account %d","uuid":%q}`, i, accountID.String()))
+			require.NoError(b, store.StoreAccount(walletID, accountID, accountData))
+		}
+
+		b.Run(fmt.Sprintf("Cached/%d", accounts), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// New store each time, so the cache starts cold.
+				store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+				retrieved := 0
+				for range store.RetrieveAccounts(walletID) {
+					retrieved++
+				}
+				require.Equal(b, accounts, retrieved)
+			}
+		})
+
+		b.Run(fmt.Sprintf("Uncached/%d", accounts), func(b *testing.B) {
+			if accounts > 100 && testing.Short() {
+				b.Skip("skipping uncached benchmark for large numbers of accounts in short mode")
+			}
+			walletPath := filepath.Join(path, walletID.String())
+			for i := 0; i < b.N; i++ {
+				files, err := os.ReadDir(walletPath)
+				require.NoError(b, err)
+				retrieved := 0
+				for _, file := range files {
+					if _, err := uuid.Parse(file.Name()); err != nil || file.Name() == walletID.String() {
+						continue
+					}
+					data, err := os.ReadFile(filepath.Join(walletPath, file.Name()))
+					require.NoError(b, err)
+					// Derive the key from the salt that starts the payload.
+					salt := data[envelopeHeaderLen : envelopeHeaderLen+32]
+					_ = pbkdf2.Key(passphrase, salt, 262144, 32, sha256.New)
+					retrieved++
+				}
+				require.Equal(b, accounts, retrieved)
+			}
+		})
+	}
+}
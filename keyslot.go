@@ -0,0 +1,660 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// keySlotsVersion is the version of the key slots file format.
+	keySlotsVersion = 1
+	// keySlotsEncryptorName is the name of the encryptor for a store with key slots.
+	keySlotsEncryptorName = "keyslots/aes-256-gcm"
+	// dataKeyLen is the length of the data key for a store with key slots.
+	dataKeyLen = 32
+	// recoveryKeyLen is the length of a generated recovery key, before encoding.
+	recoveryKeyLen = 32
+)
+
+// KeySlotKind is the kind of secret that protects a key slot.
+type KeySlotKind string
+
+// Kinds of key slot.
+const (
+	// KeySlotPassphrase is a key slot protected by a passphrase.
+	KeySlotPassphrase KeySlotKind = "passphrase"
+	// KeySlotKeyFile is a key slot protected by the contents of a key file.
+	KeySlotKeyFile KeySlotKind = "keyfile"
+	// KeySlotRecovery is a key slot protected by a generated recovery key.
+	KeySlotRecovery KeySlotKind = "recovery"
+)
+
+// KeySlot is a key slot in a store.
+type KeySlot struct {
+	// ID is the identifier of the slot.
+	ID uint64
+	// Label is the label given to the slot when it was added.
+	Label string
+	// Kind is the kind of secret that protects the slot.
+	Kind KeySlotKind
+}
+
+// keySlots is the contents of the key slots file.
+type keySlots struct {
+	// Version is the version of the key slots file format.
+	Version uint64 `json:"version"`
+	// Slots are the key slots.
+	Slots []*keySlot `json:"slots"`
+	// Next is the ID of the next slot to be added.
+	Next uint64 `json:"next"`
+}
+
+// keySlot holds the store's data key, wrapped with a key derived from a secret.
+type keySlot struct {
+	// ID is the identifier of the slot, which is never reused.
+	ID uint64 `json:"id"`
+	// Label is a label for the slot.
+	Label string `json:"label,omitempty"`
+	// Kind is the kind of secret that protects the slot.
+	Kind KeySlotKind `json:"kind"`
+	// KDFParams are the function with which the wrapping key is derived from
+	// the secret, and its parameters.
+	*KDFParams
+	// Salt is the hex-encoded salt for the key derivation function.
+	Salt string `json:"salt"`
+	// Key is the hex-encoded wrapped data key.
+	Key string `json:"key"`
+}
+
+// WithKeySlotPassphrase sets the store to encrypt data with a data key held in
+// key slots, unlocked with the given passphrase.  A new store is created with
+// a single slot protected by the passphrase.  This is in place of any
+// passphrase supplied by WithPassphrase or encryptor supplied by WithEncryptor.
+func WithKeySlotPassphrase(passphrase []byte) Option {
+	return optionFunc(func(o *options) {
+		o.keySlotKind = KeySlotPassphrase
+		o.keySlotSecret = func() ([]byte, error) {
+			return passphrase, nil
+		}
+	})
+}
+
+// WithKeySlotKeyFile sets the store to encrypt data with a data key held in
+// key slots, unlocked with the contents of the given key file.  A new store
+// is created with a single slot protected by the key file.  This is in place
+// of any passphrase supplied by WithPassphrase or encryptor supplied by
+// WithEncryptor.
+func WithKeySlotKeyFile(path string) Option {
+	return optionFunc(func(o *options) {
+		o.keySlotKind = KeySlotKeyFile
+		o.keySlotSecret = func() ([]byte, error) {
+			return readKeyFile(path)
+		}
+	})
+}
+
+// readKeyFile reads the secret held in a key file.
+func readKeyFile(path string) ([]byte, error) {
+	secret, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read key file")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("key file is empty")
+	}
+
+	return secret, nil
+}
+
+// keySlotEncryptor encrypts data with a random data key, which is held in
+// key slots each wrapped with a key derived from a different secret.
+type keySlotEncryptor struct {
+	path   string
+	kind   KeySlotKind
+	secret func() ([]byte, error)
+	kdf    *KDFParams
+
+	mutex   sync.Mutex
+	dataKey []byte
+	aead    Encryptor
+}
+
+// Name returns the name of the encryption scheme.
+func (e *keySlotEncryptor) Name() string {
+	return keySlotsEncryptorName
+}
+
+// Encrypt encrypts data with the data key.
+func (e *keySlotEncryptor) Encrypt(data []byte, associatedData []byte) ([]byte, error) {
+	aead, err := e.unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Encrypt(data, associatedData)
+}
+
+// Decrypt decrypts data with the data key.
+func (e *keySlotEncryptor) Decrypt(data []byte, associatedData []byte) ([]byte, error) {
+	aead, err := e.unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Decrypt(data, associatedData)
+}
+
+// unlock returns the encryptor for the data key, unwrapping the data key from
+// a key slot with the secret if it has not already been unwrapped.
+func (e *keySlotEncryptor) unlock() (Encryptor, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.aead != nil {
+		return e.aead, nil
+	}
+
+	slots, err := readKeySlots(e.path)
+	if err != nil {
+		return nil, err
+	}
+	if slots == nil {
+		return nil, ErrNoKeySlots
+	}
+	secret, err := e.secret()
+	if err != nil {
+		return nil, err
+	}
+	for _, slot := range slots.Slots {
+		dataKey, err := slot.unwrap(secret)
+		if err != nil {
+			// Not the slot for this secret.
+			continue
+		}
+		if err := e.setDataKey(dataKey); err != nil {
+			return nil, err
+		}
+		return e.aead, nil
+	}
+
+	return nil, errors.New("secret does not unlock any key slot")
+}
+
+// setDataKey sets the data key for the encryptor.
+// The caller must hold the encryptor's mutex.
+func (e *keySlotEncryptor) setDataKey(dataKey []byte) error {
+	aead, err := NewAESGCMEncryptor(dataKey)
+	if err != nil {
+		return err
+	}
+	e.dataKey = dataKey
+	e.aead = aead
+
+	return nil
+}
+
+// unlockedDataKey returns a copy of the data key, unwrapping it if required.
+func (e *keySlotEncryptor) unlockedDataKey() ([]byte, error) {
+	if _, err := e.unlock(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIncorrectPassphrase, err)
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return copyBytes(e.dataKey), nil
+}
+
+// create creates the key slots file with a new data key in a single slot
+// protected by the secret, if the file does not already exist.
+func (e *keySlotEncryptor) create() error {
+	if _, err := os.Stat(e.path); err == nil {
+		return nil
+	}
+
+	secret, err := e.secret()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(e.path), 0o700); err != nil {
+		return errors.Wrap(err, "failed to create store")
+	}
+	dataKey := make([]byte, dataKeyLen)
+	if _, err := rand.Read(dataKey); err != nil {
+		return errors.Wrap(err, "failed to generate data key")
+	}
+	slot, err := newKeySlot(0, "", e.kind, dataKey, secret, e.kdf)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&keySlots{
+		Version: keySlotsVersion,
+		Slots:   []*keySlot{slot},
+		Next:    1,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal key slots")
+	}
+	if err := createFile(e.path, data, 0o600); err != nil {
+		if os.IsExist(err) {
+			// Created concurrently by another process.
+			return nil
+		}
+		return errors.Wrap(err, "failed to write key slots")
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.setDataKey(dataKey)
+}
+
+// writeKeySlots writes a key slots file holding a single slot, protected by
+// the secret, for the encryptor's data key.
+func (e *keySlotEncryptor) writeKeySlots(secret []byte) error {
+	dataKey, err := e.unlockedDataKey()
+	if err != nil {
+		return err
+	}
+	defer zero(dataKey)
+	slot, err := newKeySlot(0, "", e.kind, dataKey, secret, e.kdf)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&keySlots{
+		Version: keySlotsVersion,
+		Slots:   []*keySlot{slot},
+		Next:    1,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal key slots")
+	}
+
+	return writeFile(e.path, data, 0o600)
+}
+
+// newKeySlot creates a key slot holding the data key wrapped with a key
+// derived from the secret with the given function, or the default function if nil.
+func newKeySlot(id uint64, label string, kind KeySlotKind, dataKey []byte, secret []byte, kdf *KDFParams) (*keySlot, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret is required")
+	}
+	salt := make([]byte, ecodecSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "failed to generate salt")
+	}
+	slot := &keySlot{
+		ID:        id,
+		Label:     label,
+		Kind:      kind,
+		KDFParams: kdfParamsOrDefault(kdf),
+		Salt:      hex.EncodeToString(salt),
+	}
+	wrapper, err := slot.wrapper(secret)
+	if err != nil {
+		return nil, err
+	}
+	key, err := wrapper.Encrypt(dataKey, slot.associatedData())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to wrap data key")
+	}
+	slot.Key = hex.EncodeToString(key)
+
+	return slot, nil
+}
+
+// unwrap returns the data key held in the slot, if the secret is that for the slot.
+func (s *keySlot) unwrap(secret []byte) ([]byte, error) {
+	wrapper, err := s.wrapper(secret)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(s.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid wrapped key")
+	}
+
+	return wrapper.Decrypt(key, s.associatedData())
+}
+
+// wrapper returns the encryptor that wraps the data key in the slot.
+func (s *keySlot) wrapper(secret []byte) (Encryptor, error) {
+	if s.KDFParams == nil {
+		return nil, errors.New("key slot does not have a key derivation function")
+	}
+	salt, err := hex.DecodeString(s.Salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid salt")
+	}
+	key, err := s.KDFParams.deriveKey(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(key)
+
+	return NewAESGCMEncryptor(key)
+}
+
+// associatedData returns the data that wrapping binds to the data key, so
+// that a wrapped key cannot be moved to another slot.
+func (s *keySlot) associatedData() []byte {
+	return []byte(fmt.Sprintf("keyslot %d", s.ID))
+}
+
+// readKeySlots reads the key slots file at the given path.
+// It returns nil without an error if the file does not exist.
+func readKeySlots(path string) (*keySlots, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read key slots")
+	}
+	slots := &keySlots{}
+	if err := json.Unmarshal(data, slots); err != nil {
+		return nil, errors.Wrap(err, "failed to parse key slots")
+	}
+	if slots.Version > keySlotsVersion {
+		return nil, fmt.Errorf("%w: key slots version %d", ErrUnsupportedVersion, slots.Version)
+	}
+
+	return slots, nil
+}
+
+// KeySlots returns the key slots of the store.
+func (s *Store) KeySlots() ([]*KeySlot, error) {
+	if _, err := s.keySlotEncryptor(); err != nil {
+		return nil, err
+	}
+	unlock, err := s.lockStore(false)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lock store")
+	}
+	defer unlock()
+
+	slots, err := readKeySlots(s.keySlotsPath())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*KeySlot, 0)
+	if slots == nil {
+		return res, nil
+	}
+	for _, slot := range slots.Slots {
+		res = append(res, &KeySlot{
+			ID:    slot.ID,
+			Label: slot.Label,
+			Kind:  slot.Kind,
+		})
+	}
+
+	return res, nil
+}
+
+// AddKeySlot adds a key slot protected by the given passphrase, returning its ID.
+func (s *Store) AddKeySlot(label string, passphrase []byte) (uint64, error) {
+	return s.addKeySlot(label, KeySlotPassphrase, passphrase)
+}
+
+// AddKeyFileSlot adds a key slot protected by the contents of the given key
+// file, returning its ID.
+func (s *Store) AddKeyFileSlot(label string, path string) (uint64, error) {
+	secret, err := readKeyFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.addKeySlot(label, KeySlotKeyFile, secret)
+}
+
+// AddRecoveryKeySlot adds a key slot protected by a newly generated recovery
+// key, returning its ID and the recovery key.  The recovery key is not held
+// by the store, so should be kept safely offline; it unlocks the store when
+// supplied to WithKeySlotPassphrase.
+func (s *Store) AddRecoveryKeySlot(label string) (uint64, []byte, error) {
+	key := make([]byte, recoveryKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return 0, nil, errors.Wrap(err, "failed to generate recovery key")
+	}
+	recoveryKey := []byte(hex.EncodeToString(key))
+	zero(key)
+
+	id, err := s.addKeySlot(label, KeySlotRecovery, recoveryKey)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return id, recoveryKey, nil
+}
+
+// addKeySlot adds a key slot protected by the given secret, returning its ID.
+func (s *Store) addKeySlot(label string, kind KeySlotKind, secret []byte) (uint64, error) {
+	var id uint64
+	err := s.updateKeySlots(func(slots *keySlots, dataKey []byte) error {
+		id = slots.Next
+		slot, err := newKeySlot(id, label, kind, dataKey, secret, s.kdf)
+		if err != nil {
+			return err
+		}
+		slots.Slots = append(slots.Slots, slot)
+		slots.Next++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RemoveKeySlot removes a key slot.  The last key slot cannot be removed.
+func (s *Store) RemoveKeySlot(id uint64) error {
+	return s.updateKeySlots(func(slots *keySlots, _ []byte) error {
+		for i, slot := range slots.Slots {
+			if slot.ID != id {
+				continue
+			}
+			if len(slots.Slots) == 1 {
+				return errors.New("cannot remove the last key slot")
+			}
+			slots.Slots = append(slots.Slots[:i], slots.Slots[i+1:]...)
+			return nil
+		}
+		return ErrKeySlotNotFound
+	})
+}
+
+// RotateKeySlot replaces the secret that protects a key slot, keeping its ID,
+// label and kind.  For a key file slot the secret is the contents of the new
+// key file.  Only the key slots file is rewritten; data in the store is not
+// re-encrypted.
+func (s *Store) RotateKeySlot(id uint64, secret []byte) error {
+	return s.updateKeySlots(func(slots *keySlots, dataKey []byte) error {
+		for i, slot := range slots.Slots {
+			if slot.ID != id {
+				continue
+			}
+			rotated, err := newKeySlot(slot.ID, slot.Label, slot.Kind, dataKey, secret, s.kdf)
+			if err != nil {
+				return err
+			}
+			slots.Slots[i] = rotated
+			return nil
+		}
+		return ErrKeySlotNotFound
+	})
+}
+
+// updateKeySlots updates the key slots file with the supplied function,
+// which is given the unlocked data key.
+func (s *Store) updateKeySlots(update func(slots *keySlots, dataKey []byte) error) error {
+	encryptor, err := s.keySlotEncryptor()
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lockStore(true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock store")
+	}
+	defer unlock()
+
+	slots, err := readKeySlots(s.keySlotsPath())
+	if err != nil {
+		return err
+	}
+	if slots == nil {
+		return ErrNoKeySlots
+	}
+	dataKey, err := encryptor.unlockedDataKey()
+	if err != nil {
+		return err
+	}
+	defer zero(dataKey)
+	if err := update(slots, dataKey); err != nil {
+		return err
+	}
+	data, err := json.Marshal(slots)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal key slots")
+	}
+
+	return writeFile(s.keySlotsPath(), data, 0o600)
+}
+
+// ConvertToKeySlots converts a store encrypted with a passphrase to encrypt
+// its data with a random data key held in key slots, with a single slot
+// protected by the given passphrase.  All data is re-encrypted with the data
+// key in the same way as ChangePassphrase, so an interrupted conversion
+// leaves the store readable with either its passphrase or, once the
+// conversion has been completed by any subsequent use of the store, the key
+// slot.  On success the store uses the key slots for all further operations,
+// and is subsequently opened with WithKeySlotPassphrase.
+// Wallets encrypted with their own passphrase are not re-encrypted.
+func (s *Store) ConvertToKeySlots(passphrase []byte) error {
+	if len(passphrase) == 0 {
+		return errors.New("passphrase is required")
+	}
+	oldEncryptor, isPassphraseEncryptor := s.storeEncryptor().(*passphraseEncryptor)
+	if !isPassphraseEncryptor {
+		return errors.New("store does not use a passphrase")
+	}
+
+	unlock, err := s.lockStore(true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock store")
+	}
+	defer unlock()
+
+	metadata, err := s.readMetadata()
+	if err != nil {
+		return err
+	}
+	if metadata != nil && metadata.Encryption != nil && metadata.Encryption.Cipher == keySlotsEncryptorName {
+		return errors.New("store already has key slots")
+	}
+
+	dataKey := make([]byte, dataKeyLen)
+	if _, err := rand.Read(dataKey); err != nil {
+		return errors.Wrap(err, "failed to generate data key")
+	}
+	newEncryptor := &keySlotEncryptor{
+		path: s.keySlotsPath(),
+		kind: KeySlotPassphrase,
+		secret: func() ([]byte, error) {
+			return passphrase, nil
+		},
+		kdf: s.kdf,
+	}
+	if err := newEncryptor.setDataKey(dataKey); err != nil {
+		return err
+	}
+	// The key slots are written first, replacing any left by an interrupted
+	// conversion, as the data key must be available once the re-encrypted data
+	// is committed.
+	if err := newEncryptor.writeKeySlots(passphrase); err != nil {
+		return err
+	}
+
+	err = s.rekey(func(file *dataFile, data []byte) ([]byte, error) {
+		if file.metadata {
+			return rekeyMetadata(data, oldEncryptor, newEncryptor)
+		}
+		if file.index && !isEnvelope(data) && len(data) == 2 {
+			// Older versions of this module did not encrypt an empty index.
+			return nil, nil
+		}
+		if !isEncrypted(data) {
+			return nil, fmt.Errorf("%w: data is not encrypted", ErrDecryptionFailed)
+		}
+		if err := s.checkBound(data); err != nil {
+			return nil, err
+		}
+		plaintext, err := plaintextOf(oldEncryptor, file.binding, data)
+		if err != nil {
+			return nil, err
+		}
+		defer zero(plaintext)
+
+		return sealData(newEncryptor, file.binding, plaintext)
+	})
+	if err != nil {
+		if interrupted, checkErr := s.hasRekeyJournal(); checkErr == nil && !interrupted {
+			// Rolled back, so the store remains encrypted with its passphrase
+			// and the key slots are not required.
+			_ = removeFile(s.keySlotsPath())
+		}
+		return err
+	}
+	if err := s.ensureRekeyedMetadata(newEncryptor); err != nil {
+		return err
+	}
+
+	s.setEncryptor(newEncryptor)
+
+	return nil
+}
+
+// setEncryptor sets the encryptor for the store, in place of any passphrase.
+// As with setPassphrase, the previous key cache is retired.
+func (s *Store) setEncryptor(encryptor Encryptor) {
+	s.keysMutex.Lock()
+	defer s.keysMutex.Unlock()
+
+	if s.keys != nil {
+		s.keys.retire()
+	}
+	s.passphrase = nil
+	s.passphraseFunc = nil
+	s.keys = nil
+	s.encryptor = encryptor
+}
+
+// keySlotEncryptor returns the store's encryptor if the store uses key slots.
+func (s *Store) keySlotEncryptor() (*keySlotEncryptor, error) {
+	encryptor, isKeySlotEncryptor := s.storeEncryptor().(*keySlotEncryptor)
+	if !isKeySlotEncryptor {
+		return nil, errors.New("store does not use key slots")
+	}
+
+	return encryptor, nil
+}
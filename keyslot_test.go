@@ -0,0 +1,178 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+func TestKeySlots(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+
+	store, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithCreate(true), filesystem.WithKeySlotPassphrase(passphrase))
+	require.NoError(t, err)
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+	accountPath := filepath.Join(path, walletID.String(), accountID.String())
+	encryptedAccount, err := os.ReadFile(accountPath)
+	require.NoError(t, err)
+
+	slots, err := store.KeySlots()
+	require.NoError(t, err)
+	require.Equal(t, []*filesystem.KeySlot{{ID: 0, Kind: filesystem.KeySlotPassphrase}}, slots)
+
+	// Add slots of each kind.
+	secondPassphrase := []byte("second")
+	secondID, err := store.AddKeySlot("second", secondPassphrase)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), secondID)
+	keyFile := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d.key", t.Name(), rand.Int31()))
+	defer os.Remove(keyFile)
+	require.NoError(t, os.WriteFile(keyFile, []byte{0x00, 0x01, 0x02, 0x03}, 0o600))
+	keyFileID, err := store.AddKeyFileSlot("key file", keyFile)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), keyFileID)
+	recoveryID, recoveryKey, err := store.AddRecoveryKeySlot("recovery")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), recoveryID)
+	require.Len(t, recoveryKey, 64)
+
+	slots, err = store.KeySlots()
+	require.NoError(t, err)
+	require.Equal(t, []*filesystem.KeySlot{
+		{ID: 0, Kind: filesystem.KeySlotPassphrase},
+		{ID: 1, Label: "second", Kind: filesystem.KeySlotPassphrase},
+		{ID: 2, Label: "key file", Kind: filesystem.KeySlotKeyFile},
+		{ID: 3, Label: "recovery", Kind: filesystem.KeySlotRecovery},
+	}, slots)
+
+	// Each slot unlocks the store.
+	for _, opt := range []filesystem.Option{
+		filesystem.WithKeySlotPassphrase(passphrase),
+		filesystem.WithKeySlotPassphrase(secondPassphrase),
+		filesystem.WithKeySlotKeyFile(keyFile),
+		filesystem.WithKeySlotPassphrase(recoveryKey),
+	} {
+		unlocked, err := filesystem.Open(filesystem.WithLocation(path), opt)
+		require.NoError(t, err)
+		data, err := unlocked.RetrieveAccount(walletID, accountID)
+		require.NoError(t, err)
+		require.Equal(t, accountData, data)
+	}
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithKeySlotPassphrase([]byte("wrong")))
+	require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+	require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+	_, err = filesystem.Open(filesystem.WithLocation(path))
+	require.True(t, errors.Is(err, filesystem.ErrPassphraseRequired))
+
+	// Rotating a slot changes its secret without rewriting data.
+	newPassphrase := []byte("new passphrase")
+	require.NoError(t, store.RotateKeySlot(0, newPassphrase))
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithKeySlotPassphrase(passphrase))
+	require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithKeySlotPassphrase(newPassphrase))
+	require.NoError(t, err)
+	data, err := os.ReadFile(accountPath)
+	require.NoError(t, err)
+	require.Equal(t, encryptedAccount, data)
+	require.True(t, errors.Is(store.RotateKeySlot(99, newPassphrase), filesystem.ErrKeySlotNotFound))
+
+	// Removing a slot stops its secret unlocking the store.
+	require.NoError(t, store.RemoveKeySlot(recoveryID))
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithKeySlotPassphrase(recoveryKey))
+	require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+	require.True(t, errors.Is(store.RemoveKeySlot(recoveryID), filesystem.ErrKeySlotNotFound))
+
+	// Slot IDs are not reused.
+	id, err := store.AddKeySlot("", []byte("another"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), id)
+
+	// The last slot cannot be removed.
+	for _, id := range []uint64{0, 1, 2} {
+		require.NoError(t, store.RemoveKeySlot(id))
+	}
+	require.EqualError(t, store.RemoveKeySlot(4), "cannot remove the last key slot")
+}
+
+func TestKeySlotsNotInUse(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("test"))).(*filesystem.Store)
+
+	_, err := store.KeySlots()
+	require.EqualError(t, err, "store does not use key slots")
+	_, err = store.AddKeySlot("", []byte("test"))
+	require.EqualError(t, err, "store does not use key slots")
+}
+
+func TestConvertToKeySlots(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+	slotPassphrase := []byte("slot")
+
+	store, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithCreate(true), filesystem.WithPassphrase(passphrase))
+	require.NoError(t, err)
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+
+	// A store encrypted with a passphrase does not have key slots until it is converted.
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithKeySlotPassphrase(slotPassphrase))
+	require.True(t, errors.Is(err, filesystem.ErrNoKeySlots))
+	require.NoError(t, store.ConvertToKeySlots(slotPassphrase))
+	data, err := store.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, data)
+	require.EqualError(t, store.ConvertToKeySlots(slotPassphrase), "store does not use a passphrase")
+
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+	require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+	converted, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithKeySlotPassphrase(slotPassphrase))
+	require.NoError(t, err)
+	data, err = converted.RetrieveWalletByID(walletID)
+	require.NoError(t, err)
+	require.Equal(t, walletData, data)
+	data, err = converted.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, data)
+	_, err = converted.AddKeySlot("second", []byte("second"))
+	require.NoError(t, err)
+
+	// An unencrypted store cannot be converted.
+	unencrypted := filesystem.New(filesystem.WithLocation(filepath.Join(path, "unencrypted"))).(*filesystem.Store)
+	require.EqualError(t, unencrypted.ConvertToKeySlots(slotPassphrase), "store does not use a passphrase")
+}
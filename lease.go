@@ -0,0 +1,326 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// leaseHeartbeatInterval is the interval at which a held lease is renewed.
+	leaseHeartbeatInterval = 10 * time.Second
+	// leaseStaleAfter is the time after the last heartbeat at which a lease
+	// held on another host is considered stale.
+	leaseStaleAfter = 6 * leaseHeartbeatInterval
+)
+
+// LeaseInfo is the information held about the holder of a wallet lease.
+type LeaseInfo struct {
+	// ID is a unique identifier for the lease.
+	ID uuid.UUID `json:"id"`
+	// Holder is the name supplied by the holder when acquiring the lease.
+	Holder string `json:"holder"`
+	// PID is the process ID of the holder.
+	PID int `json:"pid"`
+	// Hostname is the name of the host on which the holder is running.
+	Hostname string `json:"hostname"`
+	// Started is the time at which the lease was acquired.
+	Started time.Time `json:"started"`
+	// Heartbeat is the time at which the lease was last renewed.
+	Heartbeat time.Time `json:"heartbeat"`
+}
+
+// Stale returns true if the holder of the lease is no longer running.
+// A lease held on this host is stale if its process no longer exists.  A lease
+// held on another host is stale if it has not been renewed recently.
+func (l *LeaseInfo) Stale() bool {
+	if hostname, err := os.Hostname(); err == nil && hostname == l.Hostname {
+		return !processExists(l.PID)
+	}
+
+	return time.Since(l.Heartbeat) > leaseStaleAfter
+}
+
+// LeaseHeldError is returned when a wallet lease cannot be acquired because it
+// is held elsewhere.
+type LeaseHeldError struct {
+	WalletID uuid.UUID
+	Info     *LeaseInfo
+}
+
+// Error returns a description of the error.
+func (e *LeaseHeldError) Error() string {
+	msg := fmt.Sprintf("wallet %s is in use by %q (pid %d on %s since %s, last heartbeat %s)",
+		e.WalletID,
+		e.Info.Holder,
+		e.Info.PID,
+		e.Info.Hostname,
+		e.Info.Started.Format(time.RFC3339),
+		e.Info.Heartbeat.Format(time.RFC3339),
+	)
+	if e.Info.Stale() {
+		msg += "; the lease appears to be stale and can be broken"
+	}
+
+	return msg
+}
+
+// Is allows the error to match ErrLeaseHeld.
+func (e *LeaseHeldError) Is(target error) bool {
+	return target == ErrLeaseHeld
+}
+
+// WalletLease is an exclusive lease on a wallet.
+type WalletLease struct {
+	store    *Store
+	walletID uuid.UUID
+	info     *LeaseInfo
+	mutex    sync.Mutex
+	released bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// AcquireWalletLease acquires an exclusive lease on a wallet, marking it as in use by the
+// given holder.  It will return a LeaseHeldError if the lease is already held, even if the
+// existing lease is stale; stale leases must be broken explicitly with BreakWalletLease.
+// The lease is renewed in the background until it is released, or until the context is
+// cancelled at which point it is released automatically.
+func (s *Store) AcquireWalletLease(ctx context.Context, walletID uuid.UUID, holder string) (*WalletLease, error) {
+	unlock, err := s.lockWallet(walletID, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
+	if _, err := os.Stat(s.walletHeaderPath(walletID)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Wrap(ErrWalletNotFound, walletID.String())
+		}
+		return nil, errors.Wrap(err, "failed to obtain wallet information")
+	}
+
+	existing, err := s.readWalletLease(walletID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, &LeaseHeldError{WalletID: walletID, Info: existing}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to obtain hostname")
+	}
+	now := time.Now().UTC()
+	info := &LeaseInfo{
+		ID:        uuid.New(),
+		Holder:    holder,
+		PID:       os.Getpid(),
+		Hostname:  hostname,
+		Started:   now,
+		Heartbeat: now,
+	}
+	if err := s.writeWalletLease(walletID, info); err != nil {
+		return nil, err
+	}
+
+	lease := &WalletLease{
+		store:    s,
+		walletID: walletID,
+		info:     info,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go lease.heartbeat(ctx)
+
+	return lease, nil
+}
+
+// RetrieveWalletLease retrieves information about the current lease on a wallet.
+// It returns nil if the wallet is not leased.
+func (s *Store) RetrieveWalletLease(walletID uuid.UUID) (*LeaseInfo, error) {
+	unlock, err := s.lockWallet(walletID, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
+	return s.readWalletLease(walletID)
+}
+
+// BreakWalletLease breaks the lease on a wallet, allowing it to be acquired again.
+// Unless force is set the lease is only broken if it is stale; otherwise a LeaseHeldError
+// is returned.  Breaking a lease that is held by a running process can result in the
+// wallet being used by more than one process, so should be done with care.
+func (s *Store) BreakWalletLease(walletID uuid.UUID, force bool) error {
+	unlock, err := s.lockWallet(walletID, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
+	existing, err := s.readWalletLease(walletID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return nil
+	}
+	if !force && !existing.Stale() {
+		return &LeaseHeldError{WalletID: walletID, Info: existing}
+	}
+
+	if err := removeFile(s.walletLeasePath(walletID)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove lease")
+	}
+
+	return nil
+}
+
+// Info returns information about the lease.
+func (l *WalletLease) Info() LeaseInfo {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return *l.info
+}
+
+// Done returns a channel that is closed when the lease is no longer held, either
+// because it has been released or because it has been broken by another process.
+func (l *WalletLease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Release releases the lease.
+func (l *WalletLease) Release() error {
+	l.mutex.Lock()
+	if l.released {
+		l.mutex.Unlock()
+		return nil
+	}
+	l.released = true
+	close(l.stop)
+	l.mutex.Unlock()
+	<-l.done
+
+	unlock, err := l.store.lockWallet(l.walletID, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
+	existing, err := l.store.readWalletLease(l.walletID)
+	if err != nil {
+		return err
+	}
+	if existing == nil || existing.ID != l.info.ID {
+		// Lease has been broken; nothing to release.
+		return nil
+	}
+	if err := removeFile(l.store.walletLeasePath(l.walletID)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove lease")
+	}
+
+	return nil
+}
+
+// heartbeat renews the lease periodically until it is released or lost.
+func (l *WalletLease) heartbeat(ctx context.Context) {
+	defer close(l.done)
+	ticker := time.NewTicker(leaseHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ctx.Done():
+			go func() {
+				_ = l.Release()
+			}()
+			return
+		case <-ticker.C:
+			if lost := l.renew(); lost {
+				return
+			}
+		}
+	}
+}
+
+// renew updates the heartbeat of the lease.
+// It returns true if the lease has been lost.
+func (l *WalletLease) renew() bool {
+	unlock, err := l.store.lockWallet(l.walletID, true)
+	if err != nil {
+		// Try again at the next heartbeat.
+		return false
+	}
+	defer unlock()
+
+	existing, err := l.store.readWalletLease(l.walletID)
+	if err != nil {
+		return false
+	}
+	if existing == nil || existing.ID != l.info.ID {
+		return true
+	}
+
+	l.mutex.Lock()
+	l.info.Heartbeat = time.Now().UTC()
+	info := *l.info
+	l.mutex.Unlock()
+	_ = l.store.writeWalletLease(l.walletID, &info)
+
+	return false
+}
+
+// readWalletLease reads the lease for a wallet.
+// It returns nil if the wallet is not leased.
+func (s *Store) readWalletLease(walletID uuid.UUID) (*LeaseInfo, error) {
+	data, err := os.ReadFile(s.walletLeasePath(walletID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read lease")
+	}
+	info := &LeaseInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, errors.Wrap(err, "failed to parse lease")
+	}
+
+	return info, nil
+}
+
+// writeWalletLease writes the lease for a wallet.
+func (s *Store) writeWalletLease(walletID uuid.UUID, info *LeaseInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal lease")
+	}
+	if err := writeFile(s.walletLeasePath(walletID), data, 0o600); err != nil {
+		return errors.Wrap(err, "failed to write lease")
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+func TestWalletLease(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	data := []byte(fmt.Sprintf(`{"uuid":%q,"name":%q}`, walletID, walletName))
+	require.NoError(t, store.StoreWallet(walletID, walletName, data))
+
+	lease, err := store.AcquireWalletLease(ctx, walletID, "validator client 1")
+	require.NoError(t, err)
+	require.Equal(t, "validator client 1", lease.Info().Holder)
+	require.Equal(t, os.Getpid(), lease.Info().PID)
+
+	_, err = store.AcquireWalletLease(ctx, walletID, "validator client 2")
+	require.True(t, errors.Is(err, filesystem.ErrLeaseHeld))
+	var heldErr *filesystem.LeaseHeldError
+	require.True(t, errors.As(err, &heldErr))
+	require.Equal(t, "validator client 1", heldErr.Info.Holder)
+	require.Contains(t, err.Error(), "validator client 1")
+
+	info, err := store.RetrieveWalletLease(walletID)
+	require.NoError(t, err)
+	require.Equal(t, lease.Info().ID, info.ID)
+	require.False(t, info.Stale())
+
+	// The lease is held by a live process, so cannot be broken without force.
+	err = store.BreakWalletLease(walletID, false)
+	require.True(t, errors.Is(err, filesystem.ErrLeaseHeld))
+
+	require.NoError(t, lease.Release())
+	<-lease.Done()
+	info, err = store.RetrieveWalletLease(walletID)
+	require.NoError(t, err)
+	require.Nil(t, info)
+
+	lease, err = store.AcquireWalletLease(ctx, walletID, "validator client 2")
+	require.NoError(t, err)
+	require.NoError(t, lease.Release())
+}
+
+func TestWalletLeaseNonExistentWallet(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+
+	_, err := store.AcquireWalletLease(context.Background(), uuid.New(), "validator client")
+	require.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
+}
+
+func TestWalletLeaseContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	data := []byte(fmt.Sprintf(`{"uuid":%q,"name":%q}`, walletID, walletName))
+	require.NoError(t, store.StoreWallet(walletID, walletName, data))
+
+	lease, err := store.AcquireWalletLease(ctx, walletID, "validator client")
+	require.NoError(t, err)
+	cancel()
+	<-lease.Done()
+
+	require.Eventually(t, func() bool {
+		info, err := store.RetrieveWalletLease(walletID)
+		return err == nil && info == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBreakStaleWalletLease(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	data := []byte(fmt.Sprintf(`{"uuid":%q,"name":%q}`, walletID, walletName))
+	require.NoError(t, store.StoreWallet(walletID, walletName, data))
+
+	// Create a lease as if held by a process on another host that has since died.
+	staleInfo := &filesystem.LeaseInfo{
+		ID:        uuid.New(),
+		Holder:    "crashed validator client",
+		PID:       1234,
+		Hostname:  "other-host.invalid",
+		Started:   time.Now().Add(-24 * time.Hour),
+		Heartbeat: time.Now().Add(-time.Hour),
+	}
+	leaseData, err := json.Marshal(staleInfo)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), ".lease"), leaseData, 0o600))
+
+	_, err = store.AcquireWalletLease(ctx, walletID, "validator client")
+	require.True(t, errors.Is(err, filesystem.ErrLeaseHeld))
+	require.Contains(t, err.Error(), "stale")
+
+	require.NoError(t, store.BreakWalletLease(walletID, false))
+
+	lease, err := store.AcquireWalletLease(ctx, walletID, "validator client")
+	require.NoError(t, err)
+	require.NoError(t, lease.Release())
+}
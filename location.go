@@ -0,0 +1,59 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// checkLocation checks that the store's location is a usable directory,
+// creating it if it does not exist and create is set.
+func (s *Store) checkLocation(create bool) error {
+	info, err := os.Stat(s.location)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to access location")
+		}
+		if !create {
+			return fmt.Errorf("%w: %s", ErrLocationNotFound, s.location)
+		}
+		if err := os.MkdirAll(s.location, 0o700); err != nil {
+			return errors.Wrap(err, "failed to create location")
+		}
+		if info, err = os.Stat(s.location); err != nil {
+			return errors.Wrap(err, "failed to access location")
+		}
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.location)
+	}
+
+	return checkLocationAccess(s.location)
+}
+
+// checkVersion checks that the store's format is supported.
+func (s *Store) checkVersion() error {
+	version, err := s.version()
+	if err != nil {
+		return err
+	}
+	if version > storeVersion {
+		return fmt.Errorf("%w: store is version %d, maximum supported version is %d", ErrUnsupportedVersion, version, storeVersion)
+	}
+
+	return nil
+}
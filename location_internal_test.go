@@ -0,0 +1,50 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLocationAccess(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	require.NoError(t, os.MkdirAll(path, 0o700))
+	defer os.RemoveAll(path)
+
+	require.NoError(t, checkLocationAccess(path))
+
+	// Writable by other users.
+	require.NoError(t, os.Chmod(path, 0o777))
+	require.True(t, errors.Is(checkLocationAccess(path), ErrInsecureLocation))
+
+	// Readable by other users is fine.
+	require.NoError(t, os.Chmod(path, 0o755))
+	require.NoError(t, checkLocationAccess(path))
+
+	if os.Geteuid() != 0 {
+		// Not writable.  Root can write regardless of permissions, so this is not checked when running as root.
+		require.NoError(t, os.Chmod(path, 0o500))
+		require.ErrorContains(t, checkLocationAccess(path), "is not writable")
+		require.NoError(t, os.Chmod(path, 0o700))
+	}
+}
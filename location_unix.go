@@ -0,0 +1,43 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package filesystem
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkLocationAccess checks that the location is owned by the current user,
+// cannot be modified by other users, and is writable.
+func checkLocationAccess(path string) error {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return err
+	}
+	if uid := os.Geteuid(); int(stat.Uid) != uid {
+		return fmt.Errorf("%w: %s is owned by user %d rather than user %d", ErrInsecureLocation, path, stat.Uid, uid)
+	}
+	if stat.Mode&0o022 != 0 {
+		return fmt.Errorf("%w: %s is writable by other users (mode %#o)", ErrInsecureLocation, path, stat.Mode&0o777)
+	}
+	if err := unix.Access(path, unix.W_OK|unix.X_OK); err != nil {
+		return fmt.Errorf("%s is not writable: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// lockPollInterval is the interval between attempts to obtain a lock when
+// a lock timeout is in force.
+const lockPollInterval = 10 * time.Millisecond
+
+// errWouldBlock is returned by lockFile when a non-blocking lock cannot be obtained.
+var errWouldBlock = errors.New("lock would block")
+
+// fileLock is an advisory lock held on a lock file.
+type fileLock struct {
+	file *os.File
+}
+
+// unlock releases the lock.
+func (l *fileLock) unlock() {
+	if l.file == nil {
+		// No-op lock.
+		return
+	}
+	_ = unlockFile(l.file)
+	_ = l.file.Close()
+}
+
+// acquireLock obtains an advisory lock on the given lock file, honouring the
+// store's lock timeout and try-lock settings.
+// Shared locks are used for reading, so if the lock file cannot be created
+// because the store does not exist or is not writable a no-op lock is
+// returned rather than an error.
+func (s *Store) acquireLock(path string, exclusive bool) (*fileLock, error) {
+	file, err := openLockFile(path, exclusive)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return &fileLock{}, nil
+	}
+
+	if err := s.lockFile(file, exclusive); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &fileLock{file: file}, nil
+}
+
+// lockFile locks the file according to the store's lock settings.
+func (s *Store) lockFile(file *os.File, exclusive bool) error {
+	switch {
+	case s.tryLock:
+		if err := lockFile(file, exclusive, false); err != nil {
+			if errors.Is(err, errWouldBlock) {
+				return ErrLockUnavailable
+			}
+			return err
+		}
+	case s.lockTimeout > 0:
+		deadline := time.Now().Add(s.lockTimeout)
+		for {
+			err := lockFile(file, exclusive, false)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, errWouldBlock) {
+				return err
+			}
+			if time.Now().After(deadline) {
+				return ErrLockUnavailable
+			}
+			time.Sleep(lockPollInterval)
+		}
+	default:
+		if err := lockFile(file, exclusive, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openLockFile opens the lock file, creating it if required.
+// It returns nil without an error if a shared lock is requested and the lock
+// file cannot be created.
+func openLockFile(path string, exclusive bool) (*os.File, error) {
+	if !exclusive {
+		file, err := os.Open(path)
+		if err == nil {
+			return file, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		if !exclusive {
+			return nil, nil
+		}
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		if !exclusive {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// lockStore obtains a store-level lock.
+// Each time the lock is obtained the store is checked for an interrupted
+// re-encryption, by this or another process, which is recovered before the
+// lock is returned.
+// Exclusive locks are obtained to write to the store, so they are refused if
+// the store's format is newer than this module supports.
+func (s *Store) lockStore(exclusive bool) (func(), error) {
+	if !exclusive {
+		if _, err := os.Stat(s.location); os.IsNotExist(err) {
+			// Nothing to read, so nothing to lock.
+			return func() {}, nil
+		}
+	}
+
+	for {
+		lock, err := s.acquireLock(s.storeLockPath(), exclusive)
+		if err != nil {
+			return nil, err
+		}
+		if exclusive {
+			if err := s.checkVersion(); err != nil {
+				lock.unlock()
+				return nil, err
+			}
+		}
+		interrupted, err := s.hasRekeyJournal()
+		if err != nil {
+			lock.unlock()
+			return nil, err
+		}
+		if !interrupted {
+			return lock.unlock, nil
+		}
+		if exclusive {
+			if err := s.recoverRekey(); err != nil {
+				lock.unlock()
+				return nil, err
+			}
+			return lock.unlock, nil
+		}
+		// Recovery requires an exclusive lock, after which the shared lock is
+		// obtained again.
+		lock.unlock()
+		if err := s.recoverRekeyWithLock(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// lockWallet obtains a wallet-level lock, along with a shared store-level lock.
+// Before the lock is obtained any interrupted changes to the wallet are completed.
+// As with the store, exclusive locks are refused if the store's format is
+// newer than this module supports.
+func (s *Store) lockWallet(walletID uuid.UUID, exclusive bool) (func(), error) {
+	unlockStore, err := s.lockStore(false)
+	if err != nil {
+		return nil, err
+	}
+	if !exclusive {
+		if _, err := os.Stat(s.walletPath(walletID)); os.IsNotExist(err) {
+			// Nothing to read, so nothing to lock.
+			return unlockStore, nil
+		}
+	}
+	if err := s.ensureWalletJournalRecovered(walletID); err != nil {
+		unlockStore()
+		return nil, err
+	}
+
+	lock, err := s.acquireLock(s.walletLockPath(walletID), exclusive)
+	if err != nil {
+		unlockStore()
+		return nil, err
+	}
+	if exclusive {
+		if err := s.checkVersion(); err != nil {
+			lock.unlock()
+			unlockStore()
+			return nil, err
+		}
+	}
+
+	return func() {
+		lock.unlock()
+		unlockStore()
+	}, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix || windows
+
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletLocks(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := New(WithLocation(path)).(*Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+
+	// Hold an exclusive lock on the wallet, as if another process were writing to it.
+	unlock, err := store.lockWallet(walletID, true)
+	require.NoError(t, err)
+
+	tryStore := New(WithLocation(path), WithTryLock(true)).(*Store)
+	err = tryStore.StoreAccount(walletID, accountID, accountData)
+	require.True(t, errors.Is(err, ErrLockUnavailable))
+	err = tryStore.StoreBatch(ctx, walletID, walletName, []byte(`{"test":true}`))
+	require.True(t, errors.Is(err, ErrLockUnavailable))
+	_, err = tryStore.RetrieveAccountsIndex(walletID)
+	require.True(t, errors.Is(err, ErrLockUnavailable))
+
+	timeoutStore := New(WithLocation(path), WithLockTimeout(50*time.Millisecond)).(*Store)
+	started := time.Now()
+	err = timeoutStore.StoreAccount(walletID, accountID, accountData)
+	require.True(t, errors.Is(err, ErrLockUnavailable))
+	require.GreaterOrEqual(t, time.Since(started), 50*time.Millisecond)
+
+	// Other wallets are unaffected.
+	otherWalletID := uuid.New()
+	otherWalletData := []byte(fmt.Sprintf(`{"name":"other wallet","uuid":%q}`, otherWalletID.String()))
+	require.NoError(t, tryStore.StoreWallet(otherWalletID, "other wallet", otherWalletData))
+
+	// A blocked writer proceeds once the lock is released.
+	done := make(chan error)
+	go func() {
+		done <- store.StoreAccount(walletID, accountID, accountData)
+	}()
+	select {
+	case <-done:
+		require.Fail(t, "write completed while wallet was locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	require.NoError(t, <-done)
+
+	require.NoError(t, tryStore.StoreAccount(walletID, accountID, accountData))
+}
+
+func TestSharedLocks(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := New(WithLocation(path), WithTryLock(true)).(*Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+
+	unlock, err := store.lockWallet(walletID, false)
+	require.NoError(t, err)
+	defer unlock()
+
+	// Readers can share the wallet.
+	_, err = store.RetrieveWalletByID(walletID)
+	require.NoError(t, err)
+
+	// Writers cannot.
+	err = store.StoreWallet(walletID, walletName, walletData)
+	require.True(t, errors.Is(err, ErrLockUnavailable))
+
+	// Nor can an exclusive store-level operation.
+	err = store.CleanTempFiles()
+	require.True(t, errors.Is(err, ErrLockUnavailable))
+}
@@ -0,0 +1,31 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !unix && !windows
+
+package filesystem
+
+import (
+	"os"
+)
+
+// lockFile places an advisory lock on a file.
+// Advisory locks are not supported on this platform, so this does nothing.
+func lockFile(_ *os.File, _ bool, _ bool) error {
+	return nil
+}
+
+// unlockFile removes an advisory lock from a file.
+func unlockFile(_ *os.File) error {
+	return nil
+}
@@ -0,0 +1,552 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// storeVersion is the version of the store format written by this module.
+	// Stores without metadata, or with metadata that does not record a version,
+	// use the original format, which is version 1.
+	storeVersion = 5
+	// boundStoreVersion is the first version of the store format in which all
+	// encrypted data is bound to its location.
+	boundStoreVersion = 5
+	// storeLayout is the layout of the store, with a directory per wallet
+	// holding the wallet's header, accounts, index and batch.
+	storeLayout = "wallet-directories"
+	// The parameters used to encrypt data in the store.
+	storeCipher = "aes-256-gcm"
+	storeKDF    = KDFPBKDF2SHA256
+)
+
+// canaryPlaintext is the known plaintext that is encrypted to form the canary
+// for an encrypted store.
+var canaryPlaintext = []byte("go-eth2-wallet-store-filesystem canary")
+
+// canaryAssociatedData is the associated data with which an encryptor
+// encrypts the canary.
+var canaryAssociatedData = []byte("canary")
+
+// storeMetadata is the metadata for a store, held at the root of its location.
+type storeMetadata struct {
+	// Version is the version of the store format.
+	Version uint64 `json:"version"`
+	// Created is the time at which the store was created, if known.
+	Created *time.Time `json:"created,omitempty"`
+	// Layout is the layout of files in the store.
+	Layout string `json:"layout"`
+	// Encryption is present if the store is encrypted.
+	Encryption *encryptionMetadata `json:"encryption,omitempty"`
+}
+
+// encryptionMetadata records the parameters with which a store is encrypted.
+type encryptionMetadata struct {
+	// Cipher is the cipher with which data is encrypted, or the name of the
+	// encryptor if the store does not use a passphrase.
+	Cipher string `json:"cipher"`
+	// KDFParams are the function with which keys are derived from the
+	// passphrase, and its parameters.
+	*KDFParams
+	// Canary is the hex-encoded canary.
+	Canary string `json:"canary"`
+}
+
+// formatMigrations upgrade store metadata from the version by which they are
+// indexed to the next version.  Each operates on the decoded JSON of the
+// metadata, so that older formats do not need to be kept as types.
+var formatMigrations = map[uint64]func(metadata map[string]any) error{
+	1: migrateFormatV1,
+	2: migrateFormatV2,
+	3: migrateFormatV3,
+	4: migrateFormatV4,
+}
+
+// migrateFormatV1 upgrades metadata from version 1 to version 2, which
+// records the layout and moves the canary into the encryption parameters.
+// The creation time of a version 1 store is not known.
+func migrateFormatV1(metadata map[string]any) error {
+	if canary, exists := metadata["canary"]; exists {
+		metadata["encryption"] = map[string]any{
+			"cipher":     "aes-128-ctr",
+			"kdf":        storeKDF,
+			"iterations": ecodecPBKDF2Iterations,
+			"canary":     canary,
+		}
+		delete(metadata, "canary")
+	}
+	metadata["layout"] = storeLayout
+
+	return nil
+}
+
+// migrateFormatV2 upgrades metadata from version 2 to version 3, in which data
+// is held in envelopes.  Files written without envelopes remain readable, so
+// there is nothing to change other than the version.
+func migrateFormatV2(_ map[string]any) error {
+	return nil
+}
+
+// migrateFormatV3 upgrades metadata from version 3 to version 4, in which data
+// is encrypted with AES-256-GCM bound to its location in the store.  Files
+// encrypted with AES-128-CTR remain readable until they are next written.
+func migrateFormatV3(metadata map[string]any) error {
+	if encryption, exists := metadata["encryption"].(map[string]any); exists {
+		encryption["cipher"] = storeCipher
+	}
+
+	return nil
+}
+
+// migrateFormatV4 upgrades metadata from version 4 to version 5, in which all
+// encrypted data is bound to its location in the store.  Data encrypted without
+// a location is re-sealed before the store records this version, so there is
+// nothing to change other than the version.
+func migrateFormatV4(_ map[string]any) error {
+	return nil
+}
+
+// newMetadata creates metadata for a store encrypted with the given encryptor,
+// or unencrypted if encryptor is nil.
+func newMetadata(encryptor Encryptor) (*storeMetadata, error) {
+	created := time.Now().UTC().Truncate(time.Second)
+	metadata := &storeMetadata{
+		Version: storeVersion,
+		Created: &created,
+		Layout:  storeLayout,
+	}
+	if err := metadata.setCanary(encryptor); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+// setCanary sets the canary for the metadata, encrypted with the given encryptor.
+// If encryptor is nil the store is not encrypted and the canary is removed.
+func (m *storeMetadata) setCanary(encryptor Encryptor) error {
+	if encryptor == nil {
+		m.Encryption = nil
+		return nil
+	}
+
+	if passphraseEncryptor, isPassphraseEncryptor := encryptor.(*passphraseEncryptor); isPassphraseEncryptor {
+		// The canary is in the format used by go-ecodec if possible.
+		kdf := passphraseEncryptor.keys.kdf
+		var canary []byte
+		var err error
+		if kdf.isDefault() {
+			canary, err = ecodecEncrypt(passphraseEncryptor.keys, canaryPlaintext)
+		} else {
+			canary, err = encryptor.Encrypt(canaryPlaintext, canaryAssociatedData)
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to encrypt canary")
+		}
+		params := *kdf
+		m.Encryption = &encryptionMetadata{
+			Cipher:    storeCipher,
+			KDFParams: &params,
+			Canary:    hex.EncodeToString(canary),
+		}
+		return nil
+	}
+
+	canary, err := encryptor.Encrypt(canaryPlaintext, canaryAssociatedData)
+	if err != nil {
+		return errors.Wrap(err, "failed to encrypt canary")
+	}
+	m.Encryption = &encryptionMetadata{
+		Cipher: encryptor.Name(),
+		Canary: hex.EncodeToString(canary),
+	}
+
+	return nil
+}
+
+// checkCanary checks that the given encryptor, or lack of one, matches the canary.
+func (m *storeMetadata) checkCanary(encryptor Encryptor) error {
+	if m.Encryption == nil {
+		if encryptor != nil {
+			return ErrStoreNotEncrypted
+		}
+		return nil
+	}
+	if encryptor == nil {
+		return ErrPassphraseRequired
+	}
+
+	canary, err := hex.DecodeString(m.Encryption.Canary)
+	if err != nil {
+		return errors.Wrap(err, "invalid canary")
+	}
+	var plaintext []byte
+	passphraseEncryptor, isPassphraseEncryptor := encryptor.(*passphraseEncryptor)
+	switch {
+	case isPassphraseEncryptor && m.Encryption.KDFParams != nil && m.Encryption.KDFParams.isDefault():
+		plaintext, err = ecodecDecrypt(passphraseEncryptor.keys, canary)
+	case isPassphraseEncryptor && m.Encryption.KDFParams != nil:
+		plaintext, err = encryptor.Decrypt(canary, canaryAssociatedData)
+	case !isPassphraseEncryptor && m.Encryption.KDFParams == nil && m.Encryption.Cipher == encryptor.Name():
+		plaintext, err = encryptor.Decrypt(canary, canaryAssociatedData)
+	default:
+		// The store is encrypted by a different means.
+		if _, isKeySlotEncryptor := encryptor.(*keySlotEncryptor); isKeySlotEncryptor && m.Encryption.KDFParams != nil {
+			return fmt.Errorf("%w: store is encrypted with a passphrase", ErrNoKeySlots)
+		}
+		err = errors.New("store encrypted by a different encryptor")
+	}
+	if err != nil || !bytes.Equal(plaintext, canaryPlaintext) {
+		return fmt.Errorf("%w: %w", ErrIncorrectPassphrase, ErrDecryptionFailed)
+	}
+
+	return nil
+}
+
+// adoptKDF sets the store to derive keys with the function recorded in its
+// metadata, unless a function has been supplied.
+func (s *Store) adoptKDF() error {
+	if s.kdf != nil {
+		return nil
+	}
+	metadata, err := s.readMetadata()
+	if err != nil {
+		return err
+	}
+	if metadata == nil || metadata.Encryption == nil || metadata.Encryption.KDFParams == nil {
+		return nil
+	}
+	if err := metadata.Encryption.KDFParams.validate(); err != nil {
+		return err
+	}
+	s.kdf = metadata.Encryption.KDFParams
+
+	return nil
+}
+
+// readMetadata reads the store's metadata.
+// It returns nil without an error if the store does not have metadata.
+func (s *Store) readMetadata() (*storeMetadata, error) {
+	data, err := os.ReadFile(s.storeMetadataPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read store metadata")
+	}
+
+	return parseMetadata(data)
+}
+
+// version returns the version of the format recorded for the store, which may
+// be older than the current version.
+func (s *Store) version() (uint64, error) {
+	data, err := os.ReadFile(s.storeMetadataPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 1, nil
+		}
+		return 0, errors.Wrap(err, "failed to read store metadata")
+	}
+	version := &struct {
+		Version uint64 `json:"version"`
+	}{}
+	if err := json.Unmarshal(data, version); err != nil {
+		return 0, errors.Wrap(err, "failed to parse store metadata")
+	}
+	if version.Version == 0 {
+		// Metadata written before the format was versioned.
+		return 1, nil
+	}
+
+	return version.Version, nil
+}
+
+// parseMetadata parses the store's metadata, upgrading it to the current
+// version of the format if it is older.
+func parseMetadata(data []byte) (*storeMetadata, error) {
+	metadata := &storeMetadata{}
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return nil, errors.Wrap(err, "failed to parse store metadata")
+	}
+	if metadata.Version == 0 {
+		// Metadata written before the format was versioned.
+		metadata.Version = 1
+	}
+	if metadata.Version >= storeVersion {
+		return metadata, nil
+	}
+
+	raw := make(map[string]any)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrap(err, "failed to parse store metadata")
+	}
+	for version := metadata.Version; version < storeVersion; version++ {
+		migration, exists := formatMigrations[version]
+		if !exists {
+			return nil, fmt.Errorf("no migration from store version %d", version)
+		}
+		if err := migration(raw); err != nil {
+			return nil, errors.Wrapf(err, "failed to migrate store from version %d", version)
+		}
+		raw["version"] = version + 1
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal migrated store metadata")
+	}
+	metadata = &storeMetadata{}
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return nil, errors.Wrap(err, "failed to parse migrated store metadata")
+	}
+
+	return metadata, nil
+}
+
+// upgrade brings the store's metadata to the current version of the format
+// if it is held in an older version.  Data encrypted without being bound to its
+// location is re-sealed first, so the passphrase must have been verified.
+func (s *Store) upgrade() error {
+	version, err := s.version()
+	if err != nil {
+		return err
+	}
+	if version >= storeVersion {
+		return nil
+	}
+	metadata, err := s.readMetadata()
+	if err != nil {
+		return err
+	}
+	if metadata == nil {
+		// Metadata is written for stores without it once the passphrase is verified.
+		return nil
+	}
+
+	unlock, err := s.lockStore(true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock store")
+	}
+	defer unlock()
+	// Check again under the lock, in case another process has upgraded the store.
+	if version, err = s.version(); err != nil {
+		return err
+	}
+	if version >= storeVersion {
+		return nil
+	}
+	if err := s.bindData(); err != nil {
+		return errors.Wrap(err, "failed to upgrade store")
+	}
+
+	return nil
+}
+
+// bindData re-seals data encrypted without being bound to its location, and
+// records the current version of the format in the store's metadata.
+// The caller must hold an exclusive lock on the store.
+func (s *Store) bindData() error {
+	encryptor := s.storeEncryptor()
+	err := s.rekey(func(file *dataFile, data []byte) ([]byte, error) {
+		if file.metadata {
+			metadata, err := parseMetadata(data)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(metadata)
+		}
+		if !isUnbound(data) {
+			return nil, nil
+		}
+		plaintext, err := plaintextOf(encryptor, file.binding, data)
+		if err != nil {
+			return nil, err
+		}
+		defer zero(plaintext)
+
+		return sealData(encryptor, file.binding, plaintext)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.ensureRekeyedMetadata(encryptor)
+}
+
+// writeMetadata writes the store's metadata.
+func (s *Store) writeMetadata(metadata *storeMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal store metadata")
+	}
+	if err := os.MkdirAll(s.location, 0o700); err != nil {
+		return errors.Wrap(err, "failed to create store")
+	}
+	if err := writeFile(s.storeMetadataPath(), data, 0o600); err != nil {
+		return errors.Wrap(err, "failed to write store metadata")
+	}
+
+	return nil
+}
+
+// ensureMetadata writes the store's metadata if it does not exist and the
+// store does not yet contain any wallets.
+// Metadata is not written for existing stores without it, as there is no
+// guarantee that the store's passphrase is that used for the existing data.
+// The caller must hold a lock on the store.
+func (s *Store) ensureMetadata() error {
+	metadata, err := s.readMetadata()
+	if err != nil {
+		return err
+	}
+	if metadata != nil {
+		return nil
+	}
+	_, header, err := s.firstWalletHeader()
+	if err != nil {
+		return err
+	}
+	if header != nil {
+		return nil
+	}
+
+	if encryptor, isKeySlotEncryptor := s.storeEncryptor().(*keySlotEncryptor); isKeySlotEncryptor {
+		// The data key is required to encrypt the canary.
+		if err := encryptor.create(); err != nil {
+			return err
+		}
+	}
+	metadata, err = newMetadata(s.storeEncryptor())
+	if err != nil {
+		return err
+	}
+
+	return s.writeMetadata(metadata)
+}
+
+// rekeyMetadata re-encrypts the canary in metadata from the old encryptor to
+// the new encryptor, either of which may be nil for an unencrypted store.
+func rekeyMetadata(data []byte, oldEncryptor Encryptor, newEncryptor Encryptor) ([]byte, error) {
+	metadata, err := parseMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Encryption != nil {
+		if err := metadata.checkCanary(oldEncryptor); err != nil {
+			return nil, err
+		}
+	}
+	if err := metadata.setCanary(newEncryptor); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(metadata)
+}
+
+// verifyPassphrase checks that the store's passphrase, or lack of one, is
+// correct for the data in the store.
+// The canary in the store's metadata is used if present.  Otherwise the
+// header of a wallet is checked, and if that succeeds the metadata is
+// written so that future checks can use the canary.
+func (s *Store) verifyPassphrase() error {
+	unlock, err := s.lockStore(false)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock store")
+	}
+	metadata, err := s.readMetadata()
+	if err != nil {
+		unlock()
+		return err
+	}
+	if metadata != nil {
+		unlock()
+		return metadata.checkCanary(s.storeEncryptor())
+	}
+	walletID, header, err := s.firstWalletHeader()
+	unlock()
+	if err != nil {
+		return err
+	}
+	if header == nil {
+		// Empty store; metadata is written along with the first wallet.
+		return nil
+	}
+
+	encryptor := s.storeEncryptor()
+	switch {
+	case !isEncrypted(header) && encryptor != nil:
+		return ErrStoreNotEncrypted
+	case isEncrypted(header) && encryptor == nil:
+		return ErrPassphraseRequired
+	case isEncrypted(header):
+		if _, err := plaintextOf(encryptor, walletBinding(walletID), header); err != nil {
+			return fmt.Errorf("%w: %w", ErrIncorrectPassphrase, ErrDecryptionFailed)
+		}
+	}
+
+	// Bind the store's data and record the metadata.  This is best-effort, as
+	// the store may be read-only.
+	if unlock, err := s.lockStore(true); err == nil {
+		if existing, err := s.readMetadata(); err == nil && existing == nil {
+			_ = s.bindData()
+		}
+		unlock()
+	}
+
+	return nil
+}
+
+// firstWalletHeader returns the ID and raw data of the header of the first
+// wallet found in the store, or nil data if the store does not contain any wallets.
+func (s *Store) firstWalletHeader() (uuid.UUID, []byte, error) {
+	entries, err := os.ReadDir(s.location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return uuid.Nil, nil, nil
+		}
+		return uuid.Nil, nil, errors.Wrap(err, "failed to read store")
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		walletID, err := uuid.Parse(entry.Name())
+		if err != nil || s.hasWalletPassphrase(walletID) {
+			continue
+		}
+		data, err := os.ReadFile(s.walletHeaderPath(walletID))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return uuid.Nil, nil, errors.Wrapf(err, "failed to read wallet at %s", filepath.Join(s.location, entry.Name()))
+		}
+		if len(data) > 0 {
+			return walletID, data, nil
+		}
+	}
+
+	return uuid.Nil, nil, nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// MigrationReport is a report of the changes made to the files in a store by a migration.
+type MigrationReport struct {
+	// Converted are the paths of the files that were converted.
+	Converted []string
+	// Unchanged are the paths of the files that were already in the required form.
+	Unchanged []string
+	// Verified is the number of files that were checked after the migration.
+	Verified int
+}
+
+// MigrateToEncrypted encrypts an unencrypted store in place with the given passphrase.
+// Wallets encrypted with their own passphrase are not migrated, here or by MigrateToPlaintext.
+// Files that are already encrypted with the passphrase are left unchanged, so a store
+// that has been partially encrypted can also be migrated.  Every file is verified once
+// the migration is complete.  On success the store uses the passphrase for all further
+// operations.
+func (s *Store) MigrateToEncrypted(passphrase []byte) (*MigrationReport, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is required")
+	}
+
+	encryptor := &passphraseEncryptor{keys: newKeyCache(passphrase, s.kdf)}
+	report, err := s.migrate(encryptor, encryptor, func(file *dataFile, plaintext []byte) ([]byte, error) {
+		return sealData(encryptor, file.binding, plaintext)
+	})
+	if err != nil {
+		encryptor.keys.clear()
+		return nil, err
+	}
+	s.setPassphrase(passphrase, encryptor.keys)
+
+	return report, nil
+}
+
+// MigrateToPlaintext decrypts a store encrypted with the given passphrase in place.
+// Files that are already unencrypted are left unchanged.  Every file is verified once
+// the migration is complete.  On success the store no longer encrypts data.
+func (s *Store) MigrateToPlaintext(passphrase []byte) (*MigrationReport, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is required")
+	}
+
+	encryptor := &passphraseEncryptor{keys: newKeyCache(passphrase, s.kdf)}
+	defer encryptor.keys.clear()
+	report, err := s.migrate(encryptor, nil, func(file *dataFile, plaintext []byte) ([]byte, error) {
+		return sealData(nil, file.binding, plaintext)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.setPassphrase(nil, nil)
+
+	return report, nil
+}
+
+// migrate converts each data file in the store with the supplied function,
+// which is given the plaintext of the file.  Existing files are decrypted with
+// the supplied encryptor if they are encrypted.  The store's metadata is updated
+// for the new encryptor, which is nil if the store will no longer be encrypted.
+func (s *Store) migrate(encryptor Encryptor, newEncryptor Encryptor, convert func(file *dataFile, plaintext []byte) ([]byte, error)) (*MigrationReport, error) {
+	unlock, err := s.lockStore(true)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lock store")
+	}
+	defer unlock()
+
+	report := &MigrationReport{
+		Converted: make([]string, 0),
+		Unchanged: make([]string, 0),
+	}
+	type verification struct {
+		file     *dataFile
+		checksum [sha256.Size]byte
+	}
+	verifications := make([]*verification, 0)
+	err = s.rekey(func(file *dataFile, data []byte) ([]byte, error) {
+		if file.metadata {
+			return rekeyMetadata(data, encryptor, newEncryptor)
+		}
+		if file.index && !isEnvelope(data) && len(data) == 2 {
+			// Older versions of this module did not encrypt an empty index.
+			report.Unchanged = append(report.Unchanged, file.path)
+			verifications = append(verifications, &verification{file: file, checksum: sha256.Sum256(data)})
+			return nil, nil
+		}
+		if err := s.checkBound(data); err != nil {
+			return nil, err
+		}
+		plaintext, err := plaintextOf(encryptor, file.binding, data)
+		if err != nil {
+			return nil, err
+		}
+		verifications = append(verifications, &verification{file: file, checksum: sha256.Sum256(plaintext)})
+		converted, err := convert(file, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		if isEncrypted(converted) == isEncrypted(data) {
+			report.Unchanged = append(report.Unchanged, file.path)
+			return nil, nil
+		}
+		report.Converted = append(report.Converted, file.path)
+		return converted, nil
+	})
+	if err == nil {
+		err = s.ensureRekeyedMetadata(newEncryptor)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify every file.
+	for _, verification := range verifications {
+		path := verification.file.path
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s for verification", path)
+		}
+		plaintext, err := plaintextOf(encryptor, verification.file.binding, data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to verify %s", path)
+		}
+		if sha256.Sum256(plaintext) != verification.checksum {
+			return nil, fmt.Errorf("verification of %s failed: contents changed", path)
+		}
+		report.Verified++
+	}
+
+	return report, nil
+}
+
+// isEncrypted returns true if the data is encrypted.
+func isEncrypted(data []byte) bool {
+	if isEnvelope(data) {
+		return data[5] == envelopeEncrypted
+	}
+
+	return len(data) >= ecodecHeaderLen && data[0] == ecodecVersion
+}
+
+// isUnbound returns true if the data is encrypted without being bound to its
+// location, as written by versions of this module before the store's format
+// bound data to its location.
+func isUnbound(data []byte) bool {
+	if isEnvelope(data) {
+		return data[5] == envelopeEncrypted && data[6] == envelopeCipherAES128CTR
+	}
+
+	return isEncrypted(data)
+}
+
+// plaintextOf returns the plaintext of data that may or may not be encrypted,
+// and may or may not be held in an envelope.
+func plaintextOf(encryptor Encryptor, binding *fileBinding, data []byte) ([]byte, error) {
+	if isEnvelope(data) {
+		plaintext, _, err := unsealData(encryptor, binding, data)
+		return plaintext, err
+	}
+	if isEncrypted(data) {
+		passphraseEncryptor, isPassphraseEncryptor := encryptor.(*passphraseEncryptor)
+		if !isPassphraseEncryptor {
+			return nil, fmt.Errorf("%w: data encrypted with a passphrase", ErrDecryptionFailed)
+		}
+		plaintext, err := ecodecDecrypt(passphraseEncryptor.keys, data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+		}
+		return plaintext, nil
+	}
+	if json.Valid(bytes.TrimSpace(data)) {
+		return data, nil
+	}
+
+	return nil, errors.New("data is neither encrypted nor valid plaintext")
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+	store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+	require.NoError(t, store.StoreAccountsIndex(walletID, []byte("[]")))
+	batchData := []byte(`{"test":true,"padding":"0123456789"}`)
+	require.NoError(t, store.StoreBatch(ctx, walletID, walletName, batchData))
+
+	_, err := store.MigrateToEncrypted(nil)
+	require.EqualError(t, err, "passphrase is required")
+
+	report, err := store.MigrateToEncrypted(passphrase)
+	require.NoError(t, err)
+	// Wallet, account, index, batch and the index of wallet names.
+	require.Len(t, report.Converted, 5)
+	require.Len(t, report.Unchanged, 0)
+	require.Equal(t, 5, report.Verified)
+
+	// Data is now encrypted on disk.
+	onDisk, err := os.ReadFile(filepath.Join(path, walletID.String(), accountID.String()))
+	require.NoError(t, err)
+	require.NotEqual(t, accountData, onDisk)
+
+	// The migrated store continues to work, encrypting new data.
+	retrievedAccountData, err := store.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, retrievedAccountData)
+	otherAccountID := uuid.New()
+	otherAccountData := []byte(fmt.Sprintf(`{"name":"other account","uuid":%q}`, otherAccountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, otherAccountID, otherAccountData))
+
+	// A store with the passphrase can read all of the data.
+	encryptedStore := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase)).(*filesystem.Store)
+	retrievedWalletData, err := encryptedStore.RetrieveWalletByID(walletID)
+	require.NoError(t, err)
+	require.Equal(t, walletData, retrievedWalletData)
+	retrievedAccountData, err = encryptedStore.RetrieveAccount(walletID, otherAccountID)
+	require.NoError(t, err)
+	require.Equal(t, otherAccountData, retrievedAccountData)
+	retrievedBatchData, err := encryptedStore.RetrieveBatch(ctx, walletID)
+	require.NoError(t, err)
+	require.Equal(t, batchData, retrievedBatchData)
+
+	// Migrating again leaves everything unchanged.
+	report, err = encryptedStore.MigrateToEncrypted(passphrase)
+	require.NoError(t, err)
+	require.Len(t, report.Converted, 0)
+	require.Len(t, report.Unchanged, 6)
+
+	// Decrypting with the wrong passphrase fails, leaving the store untouched.
+	_, err = encryptedStore.MigrateToPlaintext([]byte("wrong"))
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+	retrievedAccountData, err = encryptedStore.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, retrievedAccountData)
+
+	report, err = encryptedStore.MigrateToPlaintext(passphrase)
+	require.NoError(t, err)
+	require.Len(t, report.Converted, 6)
+	require.Len(t, report.Unchanged, 0)
+	require.Equal(t, 6, report.Verified)
+
+	// Data is now unencrypted on disk.
+	onDisk, err = os.ReadFile(filepath.Join(path, walletID.String(), accountID.String()))
+	require.NoError(t, err)
+	require.True(t, bytes.HasSuffix(onDisk, accountData))
+	plaintextStore := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+	retrievedBatchData, err = plaintextStore.RetrieveBatch(ctx, walletID)
+	require.NoError(t, err)
+	require.Equal(t, batchData, retrievedBatchData)
+}
+
+func TestMigrateBadData(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	accountID := uuid.New()
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), accountID.String()), []byte("not JSON data"), 0o600))
+
+	_, err := store.MigrateToEncrypted([]byte("test"))
+	require.ErrorContains(t, err, "data is neither encrypted nor valid plaintext")
+
+	// The store is untouched.
+	onDisk, err := os.ReadFile(filepath.Join(path, walletID.String(), walletID.String()))
+	require.NoError(t, err)
+	require.True(t, bytes.HasSuffix(onDisk, walletData))
+}
@@ -0,0 +1,121 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// WithPassphraseFile sets the encryption for the store to the passphrase held
+// in the given file, such as a systemd credential or a Kubernetes secret.  A
+// single trailing newline is removed from the passphrase.  The file must not
+// be writable by other users, or readable by users outside of its group.
+// The file is read when the passphrase is first required.
+func WithPassphraseFile(path string) Option {
+	return WithPassphraseFunc(func() ([]byte, error) {
+		return readPassphraseFile(path)
+	})
+}
+
+// WithPassphraseFD sets the encryption for the store to the passphrase read
+// from the given file descriptor, such as a pipe from the parent process.  A
+// single trailing newline is removed from the passphrase.  The descriptor is
+// read to its end and closed when the passphrase is first required, so can
+// only be used by a single store.
+func WithPassphraseFD(fd uintptr) Option {
+	return WithPassphraseFunc(func() ([]byte, error) {
+		file := os.NewFile(fd, fmt.Sprintf("passphrase descriptor %d", fd))
+		if file == nil {
+			return nil, fmt.Errorf("invalid passphrase descriptor %d", fd)
+		}
+		defer file.Close()
+		passphrase, err := io.ReadAll(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read passphrase descriptor")
+		}
+
+		return trimNewline(passphrase), nil
+	})
+}
+
+// WithPassphraseEnv sets the encryption for the store to the passphrase held
+// in the given environment variable.  The variable is read when the
+// passphrase is first required.
+func WithPassphraseEnv(name string) Option {
+	return WithPassphraseFunc(func() ([]byte, error) {
+		passphrase, exists := os.LookupEnv(name)
+		if !exists {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+
+		return []byte(passphrase), nil
+	})
+}
+
+// WithPassphraseFunc sets the encryption for the store to the passphrase
+// returned by the given function, for example to prompt the user.  Open calls
+// the function, as it verifies the passphrase before returning the store; a
+// store created with New calls it when the passphrase is first required.  The
+// function is not called again once it has returned a passphrase.
+func WithPassphraseFunc(fn func() ([]byte, error)) Option {
+	return optionFunc(func(o *options) {
+		o.passphrase = nil
+		o.passphraseFunc = fn
+	})
+}
+
+// readPassphraseFile reads the passphrase from a file, checking that the file
+// is not accessible by other users.
+func readPassphraseFile(path string) ([]byte, error) {
+	if err := checkPassphraseFileAccess(path); err != nil {
+		return nil, err
+	}
+	passphrase, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read passphrase file")
+	}
+
+	return trimNewline(passphrase), nil
+}
+
+// trimNewline removes a single trailing newline from the data.
+func trimNewline(data []byte) []byte {
+	if bytes.HasSuffix(data, []byte("\r\n")) {
+		return data[:len(data)-2]
+	}
+
+	return bytes.TrimSuffix(data, []byte("\n"))
+}
+
+// unlockPassphrase obtains the store's passphrase from its function if it has
+// not already been obtained.
+func (s *Store) unlockPassphrase() error {
+	if s.encryptor != nil || len(s.passphrase) > 0 || s.passphraseFunc == nil {
+		return nil
+	}
+	encryptor, isPassphraseEncryptor := s.storeEncryptor().(*passphraseEncryptor)
+	if !isPassphraseEncryptor {
+		return nil
+	}
+	if _, err := encryptor.keys.secret(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+// storeTestWallet stores a wallet in the store, returning its name and data.
+func storeTestWallet(t *testing.T, store *filesystem.Store) (string, []byte) {
+	t.Helper()
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+
+	return walletName, walletData
+}
+
+// passphraseDescriptors holds the files whose descriptors are handed to
+// WithPassphraseFD.  The store closes the descriptor once it has been read, so
+// the files must not be collected, as that would close the descriptor again
+// after its number could have been reused by another file.
+var passphraseDescriptors []*os.File
+
+func TestPassphraseSources(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	require.NoError(t, os.MkdirAll(dir, 0o700))
+	defer os.RemoveAll(dir)
+	passphrase := []byte("test passphrase")
+
+	passphraseFile := filepath.Join(dir, "passphrase")
+	require.NoError(t, os.WriteFile(passphraseFile, append(passphrase, '\n'), 0o400))
+	crlfPassphraseFile := filepath.Join(dir, "crlf-passphrase")
+	require.NoError(t, os.WriteFile(crlfPassphraseFile, append(passphrase, '\r', '\n'), 0o440))
+	envName := fmt.Sprintf("TEST_PASSPHRASE_%d", rand.Int31())
+	t.Setenv(envName, string(passphrase))
+	reader, writer, err := os.Pipe()
+	require.NoError(t, err)
+	_, err = writer.Write(append(passphrase, '\n'))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	passphraseDescriptors = append(passphraseDescriptors, reader)
+
+	tests := []struct {
+		name   string
+		option filesystem.Option
+	}{
+		{
+			name:   "File",
+			option: filesystem.WithPassphraseFile(passphraseFile),
+		},
+		{
+			name:   "FileCRLF",
+			option: filesystem.WithPassphraseFile(crlfPassphraseFile),
+		},
+		{
+			name:   "FD",
+			option: filesystem.WithPassphraseFD(reader.Fd()),
+		},
+		{
+			name:   "Env",
+			option: filesystem.WithPassphraseEnv(envName),
+		},
+		{
+			name: "Func",
+			option: filesystem.WithPassphraseFunc(func() ([]byte, error) {
+				return passphrase, nil
+			}),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.name)
+			store, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithCreate(true), test.option)
+			require.NoError(t, err)
+			walletName, walletData := storeTestWallet(t, store)
+
+			// The source supplies the same passphrase as WithPassphrase.
+			store, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+			require.NoError(t, err)
+			data, err := store.RetrieveWallet(walletName)
+			require.NoError(t, err)
+			require.Equal(t, walletData, data)
+		})
+	}
+}
+
+func TestPassphraseFuncLazy(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+
+	calls := 0
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphraseFunc(func() ([]byte, error) {
+		calls++
+		return []byte("test"), nil
+	})).(*filesystem.Store)
+	require.Equal(t, 0, calls)
+
+	storeTestWallet(t, store)
+	storeTestWallet(t, store)
+	require.Equal(t, 1, calls)
+}
+
+func TestPassphraseSourceErrors(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	require.NoError(t, os.MkdirAll(dir, 0o700))
+	defer os.RemoveAll(dir)
+
+	_, err := filesystem.Open(filesystem.WithLocation(dir), filesystem.WithPassphraseFunc(func() ([]byte, error) {
+		return nil, errors.New("cancelled")
+	}))
+	require.EqualError(t, err, "failed to obtain passphrase: cancelled")
+
+	_, err = filesystem.Open(filesystem.WithLocation(dir), filesystem.WithPassphraseFunc(func() ([]byte, error) {
+		return nil, nil
+	}))
+	require.EqualError(t, err, "failed to obtain passphrase: passphrase is empty")
+
+	_, err = filesystem.Open(filesystem.WithLocation(dir), filesystem.WithPassphraseEnv(fmt.Sprintf("TEST_MISSING_%d", rand.Int31())))
+	require.ErrorContains(t, err, "is not set")
+
+	_, err = filesystem.Open(filesystem.WithLocation(dir), filesystem.WithPassphraseFile(filepath.Join(dir, "missing")))
+	require.ErrorContains(t, err, "failed to access passphrase file")
+
+	if runtime.GOOS != "windows" {
+		passphraseFile := filepath.Join(dir, "passphrase")
+		require.NoError(t, os.WriteFile(passphraseFile, []byte("test"), 0o644))
+		require.NoError(t, os.Chmod(passphraseFile, 0o644))
+		_, err = filesystem.Open(filesystem.WithLocation(dir), filesystem.WithPassphraseFile(passphraseFile))
+		require.True(t, errors.Is(err, filesystem.ErrInsecurePassphraseFile))
+	}
+}
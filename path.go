@@ -41,6 +41,50 @@ func (s *Store) walletBatchPath(walletID uuid.UUID) string {
 	return filepath.FromSlash(filepath.Join(s.walletPath(walletID), "batch"))
 }
 
+func (s *Store) walletPassphraseMarkerPath(walletID uuid.UUID) string {
+	return filepath.FromSlash(filepath.Join(s.walletPath(walletID), ".passphrase"))
+}
+
+func (s *Store) walletLeasePath(walletID uuid.UUID) string {
+	return filepath.FromSlash(filepath.Join(s.walletPath(walletID), ".lease"))
+}
+
+func (s *Store) walletJournalPath(walletID uuid.UUID) string {
+	return filepath.FromSlash(filepath.Join(s.walletPath(walletID), ".journal"))
+}
+
+func (s *Store) rekeyJournalPath() string {
+	return filepath.FromSlash(filepath.Join(s.location, ".rekey"))
+}
+
+func (s *Store) storeMetadataPath() string {
+	return filepath.FromSlash(filepath.Join(s.location, "store.json"))
+}
+
+func (s *Store) keySlotsPath() string {
+	return filepath.FromSlash(filepath.Join(s.location, "keyslots.json"))
+}
+
+func (s *Store) walletNamesPath() string {
+	return filepath.FromSlash(filepath.Join(s.location, "wallets.json"))
+}
+
+func (s *Store) locksPath() string {
+	return filepath.FromSlash(filepath.Join(s.location, ".locks"))
+}
+
+func (s *Store) storeLockPath() string {
+	return filepath.FromSlash(filepath.Join(s.locksPath(), "store"))
+}
+
+func (s *Store) walletLockPath(walletID uuid.UUID) string {
+	return filepath.FromSlash(filepath.Join(s.locksPath(), walletID.String()))
+}
+
+func (s *Store) walletNamesLockPath() string {
+	return filepath.FromSlash(filepath.Join(s.locksPath(), "wallets"))
+}
+
 func (s *Store) ensureWalletPathExists(walletID uuid.UUID) error {
 	path := s.walletPath(walletID)
 	_, err := os.Stat(path)
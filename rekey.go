@@ -0,0 +1,442 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// rekeyStagePrefix is the prefix for files staged during re-encryption.
+	rekeyStagePrefix = ".rekey-"
+	// rekeyPhaseStaging is the phase during which re-encrypted files are staged.
+	rekeyPhaseStaging = "staging"
+	// rekeyPhaseCommitting is the phase during which staged files replace the originals.
+	rekeyPhaseCommitting = "committing"
+)
+
+// rekeyJournal records the progress of a store-wide re-encryption.
+// Files are recorded relative to the store's location.
+type rekeyJournal struct {
+	Phase string   `json:"phase"`
+	Files []string `json:"files,omitempty"`
+}
+
+// dataFile is a file in the store that holds encrypted-if-required data.
+type dataFile struct {
+	path     string
+	binding  *fileBinding
+	index    bool
+	metadata bool
+}
+
+// ChangePassphrase changes the passphrase with which the store is encrypted, re-encrypting
+// all wallets, accounts, indices and batches.
+// Re-encrypted files are staged alongside the originals and only replace them once every
+// file has been staged, so an interrupted change leaves the store readable with either the
+// old passphrase or, once the change has been completed by any subsequent use of the store,
+// the new passphrase.
+// Wallets encrypted with their own passphrase are not re-encrypted.
+func (s *Store) ChangePassphrase(oldPassphrase []byte, newPassphrase []byte) error {
+	if len(oldPassphrase) == 0 || len(newPassphrase) == 0 {
+		return errors.New("old and new passphrases are required")
+	}
+
+	if encryptor := s.storeEncryptor(); encryptor != nil {
+		if _, isPassphraseEncryptor := encryptor.(*passphraseEncryptor); !isPassphraseEncryptor {
+			return errors.New("store does not use a passphrase")
+		}
+	}
+
+	unlock, err := s.lockStore(true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock store")
+	}
+	defer unlock()
+
+	oldEncryptor := &passphraseEncryptor{keys: newKeyCache(oldPassphrase, nil)}
+	defer oldEncryptor.keys.clear()
+	newEncryptor := &passphraseEncryptor{keys: newKeyCache(newPassphrase, s.kdf)}
+
+	err = s.rekey(func(file *dataFile, data []byte) ([]byte, error) {
+		if file.metadata {
+			return rekeyMetadata(data, oldEncryptor, newEncryptor)
+		}
+		if file.index && !isEnvelope(data) && len(data) == 2 {
+			// Older versions of this module did not encrypt an empty index.
+			return nil, nil
+		}
+		if !isEncrypted(data) {
+			return nil, fmt.Errorf("%w: data is not encrypted", ErrDecryptionFailed)
+		}
+		if err := s.checkBound(data); err != nil {
+			return nil, err
+		}
+		plaintext, err := plaintextOf(oldEncryptor, file.binding, data)
+		if err != nil {
+			return nil, err
+		}
+		defer zero(plaintext)
+
+		return sealData(newEncryptor, file.binding, plaintext)
+	})
+	if err == nil {
+		err = s.ensureRekeyedMetadata(newEncryptor)
+	}
+	if err != nil {
+		newEncryptor.keys.clear()
+		return err
+	}
+
+	s.setPassphrase(newPassphrase, newEncryptor.keys)
+
+	return nil
+}
+
+// setPassphrase sets the passphrase for the store, along with its key cache,
+// in place of any encryptor.
+// The previous key cache is retired, zeroing its keys; operations still using
+// it continue to work, but their keys are no longer cached.
+func (s *Store) setPassphrase(passphrase []byte, keys *keyCache) {
+	s.keysMutex.Lock()
+	defer s.keysMutex.Unlock()
+
+	if s.keys != nil && s.keys != keys {
+		s.keys.retire()
+	}
+	s.passphrase = passphrase
+	s.passphraseFunc = nil
+	s.keys = keys
+	s.encryptor = nil
+}
+
+// ensureRekeyedMetadata writes the store's metadata for the given encryptor
+// if the store did not have metadata before being re-encrypted.
+func (s *Store) ensureRekeyedMetadata(encryptor Encryptor) error {
+	metadata, err := s.readMetadata()
+	if err != nil {
+		return err
+	}
+	if metadata != nil {
+		return nil
+	}
+	metadata, err = newMetadata(encryptor)
+	if err != nil {
+		return err
+	}
+
+	return s.writeMetadata(metadata)
+}
+
+// rekey transforms the contents of every data file in the store.  The
+// transform returns nil if the file does not require changing.
+// The caller must hold an exclusive lock on the store.
+func (s *Store) rekey(transform func(file *dataFile, data []byte) ([]byte, error)) error {
+	// Complete or roll back any previous re-encryption before starting.
+	if err := s.recoverRekey(); err != nil {
+		return err
+	}
+	// Complete any interrupted changes to wallets, so that their staged files
+	// are not left encrypted with the old key.
+	if err := s.recoverWalletJournals(); err != nil {
+		return err
+	}
+
+	if err := s.writeRekeyJournal(&rekeyJournal{Phase: rekeyPhaseStaging}); err != nil {
+		return err
+	}
+	staged, err := s.stageRekey(transform)
+	if err != nil {
+		// Roll back, leaving the store as it was.
+		if rollbackErr := s.rollbackRekey(); rollbackErr != nil {
+			return fmt.Errorf("%w (roll back also failed: %v)", err, rollbackErr)
+		}
+		return err
+	}
+
+	files := make([]string, len(staged))
+	for i := range staged {
+		if files[i], err = filepath.Rel(s.location, staged[i]); err != nil {
+			return errors.Wrap(err, "failed to obtain relative path")
+		}
+		files[i] = filepath.ToSlash(files[i])
+	}
+	if err := s.writeRekeyJournal(&rekeyJournal{Phase: rekeyPhaseCommitting, Files: files}); err != nil {
+		return err
+	}
+
+	return s.commitRekey(files)
+}
+
+// stageRekey stages transformed versions of the data files in the store,
+// returning the paths of the files that have been staged.
+func (s *Store) stageRekey(transform func(file *dataFile, data []byte) ([]byte, error)) ([]string, error) {
+	files, err := s.dataFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	staged := make([]string, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file.path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", file.path)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		data, err = transform(file, data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to re-encrypt %s", file.path)
+		}
+		if data == nil {
+			continue
+		}
+		if err := writeFile(rekeyStagePath(file.path), data, 0o600); err != nil {
+			return nil, errors.Wrapf(err, "failed to stage %s", file.path)
+		}
+		staged = append(staged, file.path)
+	}
+
+	return staged, nil
+}
+
+// commitRekey replaces the data files, given relative to the store's
+// location, with their staged versions.
+func (s *Store) commitRekey(files []string) error {
+	dirs := make(map[string]struct{})
+	for _, file := range files {
+		file = filepath.Join(s.location, filepath.FromSlash(file))
+		err := os.Rename(rekeyStagePath(file), file)
+		if err != nil && !os.IsNotExist(err) {
+			// Not existing means that the file has already been committed.
+			return errors.Wrapf(err, "failed to commit %s", file)
+		}
+		dirs[filepath.Dir(file)] = struct{}{}
+	}
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+
+	return s.removeRekeyJournal()
+}
+
+// rollbackRekey removes any staged files, leaving the data files as they were.
+func (s *Store) rollbackRekey() error {
+	err := s.walkStoreDirs(func(dir string, entries []os.DirEntry) error {
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), rekeyStagePrefix) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+				return errors.Wrap(err, "failed to remove staged file")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.removeRekeyJournal()
+}
+
+// recoverRekey completes or rolls back a re-encryption that was interrupted.
+// Recovery does not require any keys: a re-encryption that was interrupted
+// while staging is rolled back, and one that was interrupted while committing
+// is completed.
+// The caller must hold an exclusive lock on the store.
+func (s *Store) recoverRekey() error {
+	data, err := os.ReadFile(s.rekeyJournalPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to read re-encryption journal")
+	}
+	journal := &rekeyJournal{}
+	if err := json.Unmarshal(data, journal); err != nil {
+		return errors.Wrap(err, "failed to parse re-encryption journal")
+	}
+
+	switch journal.Phase {
+	case rekeyPhaseStaging:
+		return s.rollbackRekey()
+	case rekeyPhaseCommitting:
+		return s.commitRekey(journal.Files)
+	default:
+		return errors.Errorf("unknown re-encryption phase %q", journal.Phase)
+	}
+}
+
+// hasRekeyJournal returns true if the store has a re-encryption journal,
+// meaning that a re-encryption is in progress or was interrupted.
+func (s *Store) hasRekeyJournal() (bool, error) {
+	if _, err := os.Stat(s.rekeyJournalPath()); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to check for re-encryption journal")
+	}
+
+	return true, nil
+}
+
+// recoverRekeyWithLock recovers an interrupted re-encryption under an
+// exclusive lock on the store.
+func (s *Store) recoverRekeyWithLock() error {
+	lock, err := s.acquireLock(s.storeLockPath(), true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock store for recovery")
+	}
+	defer lock.unlock()
+
+	return s.recoverRekey()
+}
+
+// writeRekeyJournal writes the re-encryption journal.
+func (s *Store) writeRekeyJournal(journal *rekeyJournal) error {
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal re-encryption journal")
+	}
+	if err := writeFile(s.rekeyJournalPath(), data, 0o600); err != nil {
+		return errors.Wrap(err, "failed to write re-encryption journal")
+	}
+
+	return nil
+}
+
+// removeRekeyJournal removes the re-encryption journal.
+func (s *Store) removeRekeyJournal() error {
+	if err := removeFile(s.rekeyJournalPath()); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove re-encryption journal")
+	}
+
+	return nil
+}
+
+// dataFiles returns all of the files in the store that hold encrypted-if-required data.
+func (s *Store) dataFiles() ([]*dataFile, error) {
+	files := make([]*dataFile, 0)
+	err := s.walkStoreDirs(func(dir string, entries []os.DirEntry) error {
+		if dir == s.location {
+			// Metadata comes first, so that an incorrect passphrase is
+			// found before any other data is processed.
+			for _, entry := range entries {
+				if entry.Name() == filepath.Base(s.storeMetadataPath()) {
+					files = append(files, &dataFile{path: s.storeMetadataPath(), metadata: true})
+				}
+			}
+			for _, entry := range entries {
+				if entry.Name() == filepath.Base(s.walletNamesPath()) {
+					files = append(files, &dataFile{path: s.walletNamesPath(), binding: walletNamesBinding()})
+				}
+			}
+			return nil
+		}
+		walletID, err := uuid.Parse(filepath.Base(dir))
+		if err != nil {
+			// Not a wallet.
+			return nil
+		}
+		if s.hasWalletPassphrase(walletID) {
+			// Not encrypted with the store's passphrase.
+			return nil
+		}
+		walletFiles, err := s.walletDataFiles(walletID, entries)
+		if err != nil {
+			return err
+		}
+		files = append(files, walletFiles...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// walletDataFiles returns the files in a wallet that hold encrypted-if-required
+// data, given the entries of the wallet's directory.
+func (s *Store) walletDataFiles(walletID uuid.UUID, entries []os.DirEntry) ([]*dataFile, error) {
+	files := make([]*dataFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || isInternalFile(entry.Name()) {
+			continue
+		}
+		switch entry.Name() {
+		case "index":
+			files = append(files, &dataFile{path: s.walletIndexPath(walletID), binding: indexBinding(walletID), index: true})
+		case "batch":
+			files = append(files, &dataFile{path: s.walletBatchPath(walletID), binding: batchBinding(walletID)})
+		default:
+			if _, err := uuid.Parse(entry.Name()); err == nil {
+				path := filepath.Join(s.walletPath(walletID), entry.Name())
+				binding, err := bindingForPath(walletID, path)
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, &dataFile{path: path, binding: binding})
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// walkStoreDirs calls the supplied function with the entries of the store's
+// root directory and each wallet directory.
+func (s *Store) walkStoreDirs(fn func(dir string, entries []os.DirEntry) error) error {
+	entries, err := os.ReadDir(s.location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to read store")
+	}
+	if err := fn(s.location, entries); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || isInternalFile(entry.Name()) {
+			continue
+		}
+		dir := filepath.Join(s.location, entry.Name())
+		dirEntries, err := os.ReadDir(dir)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", dir)
+		}
+		if err := fn(dir, dirEntries); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rekeyStagePath returns the path at which the re-encrypted version of a file is staged.
+func rekeyStagePath(path string) string {
+	return filepath.Join(filepath.Dir(path), rekeyStagePrefix+filepath.Base(path))
+}
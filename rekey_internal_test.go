@@ -0,0 +1,179 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// setupRekeyTest creates an encrypted store with a wallet and a number of accounts.
+func setupRekeyTest(t *testing.T, passphrase []byte) (*Store, uuid.UUID, map[uuid.UUID][]byte) {
+	t.Helper()
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	t.Cleanup(func() { os.RemoveAll(path) })
+	store := New(WithLocation(path), WithPassphrase(passphrase)).(*Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	accounts := make(map[uuid.UUID][]byte)
+	for i := 0; i < 4; i++ {
+		accountID := uuid.New()
+		accountData := []byte(fmt.Sprintf(`{"name":"account %d","uuid":%q}`, i, accountID.String()))
+		require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+		accounts[accountID] = accountData
+	}
+
+	return store, walletID, accounts
+}
+
+func TestRekeyInterruptedWhileCommitting(t *testing.T) {
+	oldPassphrase := []byte("old passphrase")
+	newPassphrase := []byte("new passphrase")
+	store, walletID, accounts := setupRekeyTest(t, oldPassphrase)
+
+	oldEncryptor := NewPassphraseEncryptor(oldPassphrase)
+	newEncryptor := NewPassphraseEncryptor(newPassphrase)
+	require.NoError(t, store.writeRekeyJournal(&rekeyJournal{Phase: rekeyPhaseStaging}))
+	staged, err := store.stageRekey(func(file *dataFile, data []byte) ([]byte, error) {
+		if file.metadata {
+			return rekeyMetadata(data, oldEncryptor, newEncryptor)
+		}
+		plaintext, err := plaintextOf(oldEncryptor, file.binding, data)
+		if err != nil {
+			return nil, err
+		}
+		return sealData(newEncryptor, file.binding, plaintext)
+	})
+	require.NoError(t, err)
+	files := make([]string, len(staged))
+	for i := range staged {
+		files[i], err = filepath.Rel(store.location, staged[i])
+		require.NoError(t, err)
+	}
+	require.NoError(t, store.writeRekeyJournal(&rekeyJournal{Phase: rekeyPhaseCommitting, Files: files}))
+
+	// Commit a single file, then stop as if the process had crashed.
+	require.NoError(t, os.Rename(rekeyStagePath(staged[0]), staged[0]))
+
+	// A new store with the new passphrase completes the change and can read everything.
+	newStore := New(WithLocation(store.location), WithPassphrase(newPassphrase)).(*Store)
+	for accountID, accountData := range accounts {
+		data, err := newStore.RetrieveAccount(walletID, accountID)
+		require.NoError(t, err)
+		require.Equal(t, accountData, data)
+	}
+	_, err = os.Stat(store.rekeyJournalPath())
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestRekeyInterruptedWhileStaging(t *testing.T) {
+	oldPassphrase := []byte("old passphrase")
+	newPassphrase := []byte("new passphrase")
+	store, walletID, accounts := setupRekeyTest(t, oldPassphrase)
+
+	// Stage a single file, then stop as if the process had crashed.
+	newEncryptor := NewPassphraseEncryptor(newPassphrase)
+	require.NoError(t, store.writeRekeyJournal(&rekeyJournal{Phase: rekeyPhaseStaging}))
+	for accountID, accountData := range accounts {
+		data, err := sealData(newEncryptor, accountBinding(walletID, accountID), accountData)
+		require.NoError(t, err)
+		require.NoError(t, writeFile(rekeyStagePath(store.accountPath(walletID, accountID)), data, 0o600))
+		break
+	}
+
+	// A new store with the old passphrase rolls back the change and can read everything.
+	oldStore := New(WithLocation(store.location), WithPassphrase(oldPassphrase)).(*Store)
+	for accountID, accountData := range accounts {
+		data, err := oldStore.RetrieveAccount(walletID, accountID)
+		require.NoError(t, err)
+		require.Equal(t, accountData, data)
+	}
+	entries, err := os.ReadDir(store.walletPath(walletID))
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NotContains(t, entry.Name(), rekeyStagePrefix)
+	}
+
+	// The change can then be made in full.
+	require.NoError(t, oldStore.ChangePassphrase(oldPassphrase, newPassphrase))
+	newStore := New(WithLocation(store.location), WithPassphrase(newPassphrase)).(*Store)
+	for accountID, accountData := range accounts {
+		data, err := newStore.RetrieveAccount(walletID, accountID)
+		require.NoError(t, err)
+		require.Equal(t, accountData, data)
+	}
+}
+
+func TestRekeyInterruptedByAnotherProcess(t *testing.T) {
+	passphrase := []byte("test")
+	store, walletID, accounts := setupRekeyTest(t, passphrase)
+
+	// The store has been used, then another process stages a re-encrypted
+	// account and stops while committing, as if it had crashed.
+	var accountID uuid.UUID
+	for accountID = range accounts {
+		break
+	}
+	encryptor := NewPassphraseEncryptor(passphrase)
+	staged, err := sealData(encryptor, accountBinding(walletID, accountID), accounts[accountID])
+	require.NoError(t, err)
+	path := store.accountPath(walletID, accountID)
+	require.NoError(t, writeFile(rekeyStagePath(path), staged, 0o600))
+	relPath, err := filepath.Rel(store.location, path)
+	require.NoError(t, err)
+	require.NoError(t, store.writeRekeyJournal(&rekeyJournal{Phase: rekeyPhaseCommitting, Files: []string{filepath.ToSlash(relPath)}}))
+
+	// The interrupted re-encryption is completed before the account is next
+	// written, so the staged file does not later replace the new data.
+	accountData := []byte(fmt.Sprintf(`{"name":"updated account","uuid":%q}`, accountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+	_, err = os.Stat(store.rekeyJournalPath())
+	require.True(t, os.IsNotExist(err))
+
+	otherStore := New(WithLocation(store.location), WithPassphrase(passphrase)).(*Store)
+	data, err := otherStore.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, data)
+}
+
+func TestChangePassphraseRetiresKeys(t *testing.T) {
+	oldPassphrase := []byte("old passphrase")
+	store, walletID, accounts := setupRekeyTest(t, oldPassphrase)
+	oldKeys := store.keys
+	require.NotEmpty(t, oldKeys.keys)
+
+	require.NoError(t, store.ChangePassphrase(oldPassphrase, []byte("new passphrase")))
+	require.Empty(t, oldKeys.keys)
+
+	// Keys derived by operations still using the old cache are not kept.
+	_, err := oldKeys.key(defaultKDFParams, make([]byte, ecodecSaltLen))
+	require.NoError(t, err)
+	require.Empty(t, oldKeys.keys)
+
+	for accountID, accountData := range accounts {
+		data, err := store.RetrieveAccount(walletID, accountID)
+		require.NoError(t, err)
+		require.Equal(t, accountData, data)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+	"github.com/wealdtech/go-indexer"
+)
+
+func TestChangePassphrase(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	oldPassphrase := []byte("old passphrase")
+	newPassphrase := []byte("new passphrase")
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(oldPassphrase)).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	accountID := uuid.New()
+	accountName := "test account"
+	accountData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, accountName, accountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+	index := indexer.New()
+	index.Add(accountID, accountName)
+	indexData, err := index.Serialize()
+	require.NoError(t, err)
+	require.NoError(t, store.StoreAccountsIndex(walletID, indexData))
+	batchData := []byte(`{"test":true,"padding":"0123456789"}`)
+	require.NoError(t, store.StoreBatch(ctx, walletID, walletName, batchData))
+	// A second wallet with an empty index.
+	otherWalletID := uuid.New()
+	otherWalletData := []byte(fmt.Sprintf(`{"name":"other wallet","uuid":%q}`, otherWalletID.String()))
+	require.NoError(t, store.StoreWallet(otherWalletID, "other wallet", otherWalletData))
+	require.NoError(t, store.StoreAccountsIndex(otherWalletID, []byte("[]")))
+
+	// Wrong old passphrase fails, leaving the store untouched.
+	err = store.ChangePassphrase([]byte("wrong"), newPassphrase)
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+	_, err = store.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+
+	require.NoError(t, store.ChangePassphrase(oldPassphrase, newPassphrase))
+
+	// The store continues to work with the new passphrase.
+	retrievedAccountData, err := store.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, retrievedAccountData)
+
+	// Stores with the old passphrase can no longer read the data.
+	oldStore := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(oldPassphrase))
+	_, err = oldStore.RetrieveAccount(walletID, accountID)
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+
+	// Stores with the new passphrase can read all of the data.
+	newStore := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(newPassphrase)).(*filesystem.Store)
+	retrievedWalletData, err := newStore.RetrieveWalletByID(walletID)
+	require.NoError(t, err)
+	require.Equal(t, walletData, retrievedWalletData)
+	retrievedAccountData, err = newStore.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, retrievedAccountData)
+	retrievedIndexData, err := newStore.RetrieveAccountsIndex(walletID)
+	require.NoError(t, err)
+	require.Equal(t, indexData, retrievedIndexData)
+	retrievedBatchData, err := newStore.RetrieveBatch(ctx, walletID)
+	require.NoError(t, err)
+	require.Equal(t, batchData, retrievedBatchData)
+	retrievedIndexData, err = newStore.RetrieveAccountsIndex(otherWalletID)
+	require.NoError(t, err)
+	require.Equal(t, []byte("[]"), retrievedIndexData)
+
+	// No staged files are left behind.
+	for _, dir := range []string{path, filepath.Join(path, walletID.String())} {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		for _, entry := range entries {
+			require.NotContains(t, entry.Name(), "rekey")
+		}
+	}
+}
+
+func TestChangePassphraseConcurrent(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrases := [][]byte{[]byte("old passphrase"), []byte("new passphrase")}
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrases[0])).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+
+	// Retrieve the account while the passphrase changes underneath.
+	const readers = 4
+	errs := make([]error, readers)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				data, err := store.RetrieveAccount(walletID, accountID)
+				if err == nil && string(data) != string(accountData) {
+					err = errors.New("incorrect account data")
+				}
+				if err != nil {
+					errs[i] = err
+					return
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		require.NoError(t, store.ChangePassphrase(passphrases[i%2], passphrases[(i+1)%2]))
+	}
+	close(done)
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// RetrieveResult is the result of retrieving an item of data from the store.
+type RetrieveResult struct {
+	// Path is the path of the file or directory from which the data was retrieved.
+	Path string
+	// Data is the data retrieved.  It is nil if Err is set.
+	Data []byte
+	// Err is the error encountered when retrieving the data, if any.
+	Err error
+}
+
+// RetrieveWalletResults retrieves wallet-level data for all wallets.
+// Unlike RetrieveWallets, wallets that cannot be retrieved are returned along with the
+// reason for the failure rather than being skipped.
+// The caller must read the channel until it is closed; use RetrieveWalletsContext to be
+// able to stop early.
+func (s *Store) RetrieveWalletResults() <-chan *RetrieveResult {
+	return s.RetrieveWalletsContext(context.Background())
+}
+
+// RetrieveWalletsContext retrieves wallet-level data for all wallets.
+// Wallets that cannot be retrieved are returned along with the reason for the failure;
+// directories whose names are not wallet IDs are ignored.
+// Retrieval stops and the channel is closed when the context is cancelled, so the caller
+// can stop reading at any time by cancelling the context.  A final result holding the
+// context's error is sent, in place of the oldest unread result if the channel is full.
+func (s *Store) RetrieveWalletsContext(ctx context.Context) <-chan *RetrieveResult {
+	return sendResults(ctx, func(yield func(*RetrieveResult) bool) {
+		s.walkWallets(ctx, true, yield)
+	})
+}
+
+// RetrieveAccountResults retrieves all account-level data for a wallet.
+// Unlike RetrieveAccounts, accounts that cannot be retrieved are returned along with the
+// reason for the failure rather than being skipped.
+// The caller must read the channel until it is closed; use RetrieveAccountsContext to be
+// able to stop early.
+func (s *Store) RetrieveAccountResults(walletID uuid.UUID) <-chan *RetrieveResult {
+	return s.RetrieveAccountsContext(context.Background(), walletID)
+}
+
+// RetrieveAccountsContext retrieves all account-level data for a wallet.
+// Accounts that cannot be retrieved are returned along with the reason for the failure;
+// files whose names are not account IDs are ignored.
+// Retrieval stops and the channel is closed when the context is cancelled, so the caller
+// can stop reading at any time by cancelling the context.  A final result holding the
+// context's error is sent, in place of the oldest unread result if the channel is full.
+func (s *Store) RetrieveAccountsContext(ctx context.Context, walletID uuid.UUID) <-chan *RetrieveResult {
+	return sendResults(ctx, func(yield func(*RetrieveResult) bool) {
+		s.walkAccounts(ctx, walletID, true, yield)
+	})
+}
+
+// sendResults runs the walk in a goroutine, sending its results to the returned
+// channel until the walk completes or the context is cancelled.
+// If the context is cancelled its error is always sent as the final result.  The
+// goroutine is the only sender, so if the channel is full the oldest unread result
+// is discarded to make room without blocking; the results are incomplete regardless.
+func sendResults(ctx context.Context, walk func(yield func(*RetrieveResult) bool)) <-chan *RetrieveResult {
+	ch := make(chan *RetrieveResult, 1024)
+	go func() {
+		defer close(ch)
+		walk(func(res *RetrieveResult) bool {
+			select {
+			case ch <- res:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		if err := ctx.Err(); err != nil {
+			select {
+			case ch <- &RetrieveResult{Err: err}:
+			default:
+				select {
+				case <-ch:
+				default:
+					// The reader has made room.
+				}
+				ch <- &RetrieveResult{Err: err}
+			}
+		}
+	}()
+
+	return ch
+}
+
+// isInternalFile returns true if the name is that of a file or directory used
+// internally by the store, such as a lock or temporary file.
+func isInternalFile(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// walkWallets retrieves the header of each wallet in the store, passing the
+// result to yield until it returns false or the context is cancelled.  If lock
+// is set a shared lock is obtained on each wallet as its data is read.
+func (s *Store) walkWallets(ctx context.Context, lock bool, yield func(*RetrieveResult) bool) {
+	dirs, err := os.ReadDir(s.location)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			yield(&RetrieveResult{Path: s.location, Err: errors.Wrapf(err, "failed to read store at %s", s.location)})
+		}
+		return
+	}
+
+	for _, dir := range dirs {
+		if ctx.Err() != nil {
+			return
+		}
+		if !dir.IsDir() || isInternalFile(dir.Name()) {
+			continue
+		}
+		walletID, err := uuid.Parse(dir.Name())
+		if err != nil {
+			// Not a wallet, for example lost+found.
+			continue
+		}
+		res := s.retrieveWalletResult(walletID, lock)
+		if res == nil {
+			continue
+		}
+		if !yield(res) {
+			return
+		}
+	}
+}
+
+// retrieveWalletResult retrieves the header for a single wallet.
+// It returns nil if the wallet has been removed.
+func (s *Store) retrieveWalletResult(walletID uuid.UUID, lock bool) *RetrieveResult {
+	path := s.walletHeaderPath(walletID)
+	unlock := func() {}
+	if lock {
+		var err error
+		unlock, err = s.lockWallet(walletID, false)
+		if err != nil {
+			return &RetrieveResult{Path: path, Err: errors.Wrapf(err, "failed to lock wallet at %s", path)}
+		}
+	}
+	// Data is decrypted under the lock, so that it cannot be re-encrypted
+	// with a different passphrase between being read and decrypted.
+	defer unlock()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if _, err := os.Stat(s.walletPath(walletID)); os.IsNotExist(err) {
+				// Wallet removed since the store was read.
+				return nil
+			}
+			return &RetrieveResult{Path: path, Err: fmt.Errorf("%w: %w", ErrWalletNotFound, err)}
+		}
+		return &RetrieveResult{Path: path, Err: errors.Wrapf(err, "failed to read wallet at %s", path)}
+	}
+	data, err = s.decryptIfRequired(walletBinding(walletID), data)
+	if err != nil {
+		return &RetrieveResult{Path: path, Err: errors.Wrapf(err, "failed to decrypt wallet at %s", path)}
+	}
+
+	return &RetrieveResult{Path: path, Data: data}
+}
+
+// walkAccounts retrieves each account in a wallet, passing the result to
+// yield until it returns false or the context is cancelled.  If lock is set
+// a shared lock is obtained on the wallet as each account is read.
+func (s *Store) walkAccounts(ctx context.Context, walletID uuid.UUID, lock bool, yield func(*RetrieveResult) bool) {
+	walletPath := s.walletPath(walletID)
+	files, err := os.ReadDir(walletPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			yield(&RetrieveResult{Path: walletPath, Err: fmt.Errorf("%w: %w", ErrWalletNotFound, err)})
+		} else {
+			yield(&RetrieveResult{Path: walletPath, Err: errors.Wrapf(err, "failed to read wallet at %s", walletPath)})
+		}
+		return
+	}
+
+	walletName := walletID.String()
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return
+		}
+		if file.IsDir() || isInternalFile(file.Name()) {
+			continue
+		}
+		switch file.Name() {
+		case walletName, "index", "batch":
+			// Not accounts.
+			continue
+		}
+		accountID, err := uuid.Parse(file.Name())
+		if err != nil {
+			// Not an account, for example an editor backup.
+			continue
+		}
+		res := s.retrieveAccountResult(walletID, accountID, lock)
+		if res == nil {
+			continue
+		}
+		if !yield(res) {
+			return
+		}
+	}
+}
+
+// retrieveAccountResult retrieves a single account.
+// It returns nil if the account has been removed.
+func (s *Store) retrieveAccountResult(walletID uuid.UUID, accountID uuid.UUID, lock bool) *RetrieveResult {
+	path := s.accountPath(walletID, accountID)
+	unlock := func() {}
+	if lock {
+		var err error
+		unlock, err = s.lockWallet(walletID, false)
+		if err != nil {
+			return &RetrieveResult{Path: path, Err: errors.Wrapf(err, "failed to lock wallet for account at %s", path)}
+		}
+	}
+	defer unlock()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Account removed since the wallet was read.
+			return nil
+		}
+		return &RetrieveResult{Path: path, Err: errors.Wrapf(err, "failed to read account at %s", path)}
+	}
+	data, err = s.decryptIfRequired(accountBinding(walletID, accountID), data)
+	if err != nil {
+		return &RetrieveResult{Path: path, Err: errors.Wrapf(err, "failed to decrypt account at %s", path)}
+	}
+
+	return &RetrieveResult{Path: path, Data: data}
+}
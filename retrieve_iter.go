@@ -0,0 +1,45 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package filesystem
+
+import (
+	"context"
+	"iter"
+
+	"github.com/google/uuid"
+)
+
+// IterateWallets returns an iterator over wallet-level data for all wallets.
+// Wallets that cannot be retrieved are yielded with an error describing the file
+// and the reason for the failure; iteration continues with the next wallet.
+func (s *Store) IterateWallets() iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		s.walkWallets(context.Background(), true, func(res *RetrieveResult) bool {
+			return yield(res.Data, res.Err)
+		})
+	}
+}
+
+// IterateAccounts returns an iterator over all account-level data for a wallet.
+// Accounts that cannot be retrieved are yielded with an error describing the file
+// and the reason for the failure; iteration continues with the next account.
+func (s *Store) IterateAccounts(walletID uuid.UUID) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		s.walkAccounts(context.Background(), walletID, true, func(res *RetrieveResult) bool {
+			return yield(res.Data, res.Err)
+		})
+	}
+}
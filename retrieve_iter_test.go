@@ -0,0 +1,73 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package filesystem_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+func TestIterateWalletsAndAccounts(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("test"))).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	for i := 0; i < 3; i++ {
+		accountID := uuid.New()
+		accountData := []byte(fmt.Sprintf(`{"name":"account %d","uuid":%q}`, i, accountID.String()))
+		require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+	}
+
+	wallets := 0
+	store.IterateWallets()(func(data []byte, err error) bool {
+		require.NoError(t, err)
+		require.Equal(t, walletData, data)
+		wallets++
+		return true
+	})
+	require.Equal(t, 1, wallets)
+
+	// Stop iterating early.
+	accounts := 0
+	store.IterateAccounts(walletID)(func(_ []byte, err error) bool {
+		require.NoError(t, err)
+		accounts++
+		return accounts < 2
+	})
+	require.Equal(t, 2, accounts)
+
+	badStore := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("bad"))).(*filesystem.Store)
+	failures := 0
+	badStore.IterateAccounts(walletID)(func(data []byte, err error) bool {
+		require.Nil(t, data)
+		require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+		failures++
+		return true
+	})
+	require.Equal(t, 3, failures)
+}
@@ -0,0 +1,229 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+func TestRetrieveWalletResults(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("test")))
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	data := []byte(fmt.Sprintf(`{"uuid":%q,"name":%q}`, walletID, walletName))
+	require.NoError(t, store.StoreWallet(walletID, walletName, data))
+
+	// Directories that are not wallets are ignored.
+	require.NoError(t, os.Mkdir(filepath.Join(path, "not-a-wallet"), 0o700))
+	require.NoError(t, os.Mkdir(filepath.Join(path, "lost+found"), 0o700))
+
+	results := 0
+	for res := range store.(*filesystem.Store).RetrieveWalletResults() {
+		results++
+		require.NoError(t, res.Err)
+		require.Equal(t, data, res.Data)
+	}
+	require.Equal(t, 1, results)
+
+	// A wallet that cannot be read is reported.
+	unreadableWalletID := uuid.New()
+	unreadablePath := filepath.Join(path, unreadableWalletID.String())
+	require.NoError(t, os.Mkdir(unreadablePath, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(unreadablePath, unreadableWalletID.String()), []byte("bad"), 0o600))
+	results = 0
+	failures := 0
+	for res := range store.(*filesystem.Store).RetrieveWalletResults() {
+		results++
+		if res.Err != nil {
+			failures++
+			require.Equal(t, filepath.Join(unreadablePath, unreadableWalletID.String()), res.Path)
+		}
+	}
+	require.Equal(t, 2, results)
+	require.Equal(t, 1, failures)
+	require.NoError(t, os.RemoveAll(unreadablePath))
+
+	// Wrong passphrase is reported, rather than the store appearing to be empty.
+	store = filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("bad")))
+	for range store.RetrieveWallets() {
+		require.Fail(t, "wallet returned with bad passphrase")
+	}
+	decryptionFailures := 0
+	for res := range store.(*filesystem.Store).RetrieveWalletResults() {
+		require.Error(t, res.Err)
+		if errors.Is(res.Err, filesystem.ErrDecryptionFailed) {
+			decryptionFailures++
+			require.Contains(t, res.Err.Error(), res.Path)
+		}
+	}
+	require.Equal(t, 1, decryptionFailures)
+}
+
+func TestRetrieveAccountResults(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("test"))).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+
+	// Files that are not accounts are ignored, but an account that cannot be read is reported.
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), "notes.txt"), []byte("notes"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), accountID.String()+"~"), accountData, 0o600))
+	unreadableAccountID := uuid.New()
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), unreadableAccountID.String()), []byte("bad"), 0o600))
+
+	var accounts, failures int
+	for res := range store.RetrieveAccountResults(walletID) {
+		if res.Err != nil {
+			failures++
+			require.Equal(t, filepath.Join(path, walletID.String(), unreadableAccountID.String()), res.Path)
+			continue
+		}
+		accounts++
+		require.Equal(t, accountData, res.Data)
+	}
+	require.Equal(t, 1, accounts)
+	require.Equal(t, 1, failures)
+
+	// A non-existent wallet is reported.
+	for res := range store.RetrieveAccountResults(uuid.New()) {
+		require.True(t, errors.Is(res.Err, filesystem.ErrWalletNotFound))
+	}
+}
+
+func TestRetrieveAccountsContext(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	for i := 0; i < 10; i++ {
+		accountID := uuid.New()
+		accountData := []byte(fmt.Sprintf(`{"name":"account %d","uuid":%q}`, i, accountID.String()))
+		require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+	}
+
+	// Read everything.
+	accounts := 0
+	for res := range store.RetrieveAccountsContext(context.Background(), walletID) {
+		require.NoError(t, res.Err)
+		accounts++
+	}
+	require.Equal(t, 10, accounts)
+
+	// Cancel before reading anything.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var lastErr error
+	for res := range store.RetrieveAccountsContext(ctx, walletID) {
+		lastErr = res.Err
+	}
+	require.True(t, errors.Is(lastErr, context.Canceled))
+
+	// Cancel part way through; the channel is closed without reading further.
+	ctx, cancel = context.WithCancel(context.Background())
+	ch := store.RetrieveAccountsContext(ctx, walletID)
+	<-ch
+	cancel()
+	require.Eventually(t, func() bool {
+		for {
+			select {
+			case _, ok := <-ch:
+				if !ok {
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRetrieveAccountsContextFull(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	// More accounts than the channel holds, written directly as the store does not
+	// need to check their names.
+	for i := 0; i < 1100; i++ {
+		accountID := uuid.New()
+		accountData := []byte(fmt.Sprintf(`{"uuid":%q}`, accountID.String()))
+		require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), accountID.String()), accountData, 0o600))
+	}
+
+	// Cancel once the channel is full; the context's error is still the final result.
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := store.RetrieveAccountsContext(ctx, walletID)
+	require.Eventually(t, func() bool {
+		return len(ch) == cap(ch)
+	}, 10*time.Second, 10*time.Millisecond)
+	cancel()
+	// Allow retrieval to stop before reading, so that the channel is still full.
+	time.Sleep(100 * time.Millisecond)
+	var lastErr error
+	for res := range ch {
+		lastErr = res.Err
+	}
+	require.True(t, errors.Is(lastErr, context.Canceled))
+}
+
+func TestRetrieveWalletsContext(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+
+	for i := 0; i < 3; i++ {
+		walletID := uuid.New()
+		walletName := fmt.Sprintf("test wallet %d", i)
+		walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+		require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	wallets := 0
+	for res := range store.RetrieveWalletsContext(ctx) {
+		require.NoError(t, res.Err)
+		wallets++
+	}
+	require.Equal(t, 3, wallets)
+}
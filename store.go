@@ -15,14 +15,31 @@
 package filesystem
 
 import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
 	"github.com/shibukawa/configdir"
 	wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
 )
 
 // options are the options for the filesystem store.
 type options struct {
-	passphrase []byte
-	location   string
+	passphrase     []byte
+	passphraseFunc func() ([]byte, error)
+	location       string
+	lockTimeout    time.Duration
+	tryLock        bool
+	create         bool
+	encryptor      Encryptor
+	kdf            *KDFParams
+
+	manageAccountsIndex bool
+
+	walletPassphrase func(walletID uuid.UUID) ([]byte, error)
+
+	keySlotKind   KeySlotKind
+	keySlotSecret func() ([]byte, error)
 }
 
 // Option gives options to New.
@@ -40,6 +57,7 @@ func (f optionFunc) apply(o *options) {
 func WithPassphrase(passphrase []byte) Option {
 	return optionFunc(func(o *options) {
 		o.passphrase = passphrase
+		o.passphraseFunc = nil
 	})
 }
 
@@ -50,10 +68,66 @@ func WithLocation(b string) Option {
 	})
 }
 
+// WithLockTimeout sets the maximum time to wait for a lock on the store or a wallet.
+// If this is not set operations wait indefinitely for locks held by other processes.
+func WithLockTimeout(timeout time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.lockTimeout = timeout
+	})
+}
+
+// WithTryLock sets the store to fail immediately with ErrLockUnavailable if a lock
+// is held by another process, rather than waiting for it.
+func WithTryLock(tryLock bool) Option {
+	return optionFunc(func(o *options) {
+		o.tryLock = tryLock
+	})
+}
+
+// WithEncryptor sets the encryptor for the store, in place of encryption
+// with the passphrase supplied by WithPassphrase.
+func WithEncryptor(encryptor Encryptor) Option {
+	return optionFunc(func(o *options) {
+		o.encryptor = encryptor
+	})
+}
+
+// WithCreate sets Open to create the store's location if it does not exist,
+// rather than returning ErrLocationNotFound.
+func WithCreate(create bool) Option {
+	return optionFunc(func(o *options) {
+		o.create = create
+	})
+}
+
+// WithManagedAccountsIndex sets the store to keep the accounts index of each
+// wallet up to date as accounts are stored and deleted, rather than relying
+// on callers to store the index with StoreAccountsIndex.
+func WithManagedAccountsIndex(managed bool) Option {
+	return optionFunc(func(o *options) {
+		o.manageAccountsIndex = managed
+	})
+}
+
 // Store is the store for the wallet.
 type Store struct {
-	location   string
-	passphrase []byte
+	location       string
+	passphrase     []byte
+	passphraseFunc func() ([]byte, error)
+	lockTimeout    time.Duration
+	tryLock        bool
+	kdf            *KDFParams
+
+	walletPassphrase    func(walletID uuid.UUID) ([]byte, error)
+	manageAccountsIndex bool
+
+	keysMutex  sync.Mutex
+	keys       *keyCache
+	walletKeys map[uuid.UUID]*keyCache
+	encryptor  Encryptor
+
+	accountNamesMutex sync.Mutex
+	accountNamesCache map[uuid.UUID]*walletAccountNames
 }
 
 func defaultLocation() string {
@@ -64,6 +138,55 @@ func defaultLocation() string {
 // New creates a new filesystem store.
 // If the path is not supplied a default path is used.
 func New(opts ...Option) wtypes.Store {
+	return newStore(parseOptions(opts...))
+}
+
+// Open opens a filesystem store, checking that the store is usable before
+// returning it.  It returns an error if:
+//   - the location does not exist, unless WithCreate is set
+//   - the location is not a directory, or is not writable
+//   - the location is owned by, or can be modified by, another user
+//   - the store's format is newer than this module supports
+//   - the passphrase is incorrect for the data in the store, or missing for an encrypted store
+//   - the parameters supplied by WithKDF are invalid
+//   - the passphrase cannot be obtained from the source supplied by WithPassphraseFile or similar
+//
+// Stores in older formats are upgraded to the current format once the passphrase
+// is verified, re-sealing data that is not bound to its location.  If WithKDF is
+// not supplied, the key derivation function recorded for the store is used.
+// If the path is not supplied a default path is used.
+func Open(opts ...Option) (*Store, error) {
+	options := parseOptions(opts...)
+	if options.kdf != nil {
+		if err := options.kdf.validate(); err != nil {
+			return nil, err
+		}
+	}
+	s := newStore(options)
+	if err := s.checkLocation(options.create); err != nil {
+		return nil, err
+	}
+	if err := s.checkVersion(); err != nil {
+		return nil, err
+	}
+	if err := s.adoptKDF(); err != nil {
+		return nil, err
+	}
+	if err := s.unlockPassphrase(); err != nil {
+		return nil, err
+	}
+	if err := s.verifyPassphrase(); err != nil {
+		return nil, err
+	}
+	if err := s.upgrade(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// parseOptions parses the options, applying defaults.
+func parseOptions(opts ...Option) options {
 	options := options{
 		location: defaultLocation(),
 	}
@@ -71,10 +194,45 @@ func New(opts ...Option) wtypes.Store {
 		o.apply(&options)
 	}
 
-	return &Store{
-		location:   options.location,
-		passphrase: options.passphrase,
+	return options
+}
+
+// newStore creates a new filesystem store without accessing the filesystem.
+func newStore(options options) *Store {
+	s := &Store{
+		location:       options.location,
+		passphrase:     options.passphrase,
+		passphraseFunc: options.passphraseFunc,
+		lockTimeout:    options.lockTimeout,
+		tryLock:        options.tryLock,
+		kdf:            options.kdf,
+
+		walletPassphrase:    options.walletPassphrase,
+		manageAccountsIndex: options.manageAccountsIndex,
+	}
+
+	switch encryptor := options.encryptor.(type) {
+	case nil:
+	case *noopEncryptor:
+		s.passphrase = nil
+		s.passphraseFunc = nil
+	case *passphraseEncryptor:
+		s.passphrase = encryptor.keys.passphrase
+	default:
+		s.passphrase = nil
+		s.encryptor = encryptor
+	}
+	if options.keySlotSecret != nil {
+		s.passphrase = nil
+		s.encryptor = &keySlotEncryptor{
+			path:   s.keySlotsPath(),
+			kind:   options.keySlotKind,
+			secret: options.keySlotSecret,
+			kdf:    options.kdf,
+		}
 	}
+
+	return s
 }
 
 // Name returns the name of this store.
@@ -14,9 +14,17 @@
 package filesystem_test
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
 	wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
 )
@@ -33,3 +41,207 @@ func TestNew(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, "test", storeLocationProvider.Location())
 }
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+
+	// Empty store opens with or without a passphrase.
+	_, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithCreate(true))
+	require.NoError(t, err)
+	store, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+	require.NoError(t, err)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+	require.NoError(t, err)
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("wrong")))
+	require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+	_, err = filesystem.Open(filesystem.WithLocation(path))
+	require.True(t, errors.Is(err, filesystem.ErrPassphraseRequired))
+
+	// The canary follows a change of passphrase.
+	newPassphrase := []byte("new passphrase")
+	require.NoError(t, store.ChangePassphrase(passphrase, newPassphrase))
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+	require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(newPassphrase))
+	require.NoError(t, err)
+
+	// And migration to an unencrypted store.
+	_, err = store.MigrateToPlaintext(newPassphrase)
+	require.NoError(t, err)
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(newPassphrase))
+	require.True(t, errors.Is(err, filesystem.ErrStoreNotEncrypted))
+	_, err = filesystem.Open(filesystem.WithLocation(path))
+	require.NoError(t, err)
+}
+
+func TestOpenWithoutMetadata(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+	// Remove the metadata, as for a store created by an older version of this module.
+	require.NoError(t, os.Remove(filepath.Join(path, "store.json")))
+
+	// The passphrase is checked against the wallet.
+	_, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("wrong")))
+	require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+	_, err = filesystem.Open(filesystem.WithLocation(path))
+	require.True(t, errors.Is(err, filesystem.ErrPassphraseRequired))
+	_, err = os.Stat(filepath.Join(path, "store.json"))
+	require.True(t, os.IsNotExist(err))
+
+	// Opening with the correct passphrase records the metadata.
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(path, "store.json"))
+	require.NoError(t, err)
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("wrong")))
+	require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+}
+
+func TestOpenLocation(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+
+	_, err := filesystem.Open(filesystem.WithLocation(path))
+	require.True(t, errors.Is(err, filesystem.ErrLocationNotFound))
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithCreate(true))
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+
+	// Location is a file.
+	file := filepath.Join(path, "file")
+	require.NoError(t, os.WriteFile(file, []byte("test"), 0o600))
+	_, err = filesystem.Open(filesystem.WithLocation(file))
+	require.ErrorContains(t, err, "is not a directory")
+
+	// Store from the future.
+	require.NoError(t, os.WriteFile(filepath.Join(path, "store.json"), []byte(`{"version":999}`), 0o600))
+	_, err = filesystem.Open(filesystem.WithLocation(path))
+	require.True(t, errors.Is(err, filesystem.ErrUnsupportedVersion))
+}
+
+func TestOpenUpgrade(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+
+	// Rewrite the metadata in version 1 of the format.
+	metadataPath := filepath.Join(path, "store.json")
+	data, err := os.ReadFile(metadataPath)
+	require.NoError(t, err)
+	metadata := make(map[string]any)
+	require.NoError(t, json.Unmarshal(data, &metadata))
+	canary := metadata["encryption"].(map[string]any)["canary"]
+	data, err = json.Marshal(map[string]any{"version": 1, "canary": canary})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(metadataPath, data, 0o600))
+
+	// The canary is still checked.
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("wrong")))
+	require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+	require.NoError(t, err)
+	data, err = os.ReadFile(metadataPath)
+	require.NoError(t, err)
+	metadata = make(map[string]any)
+	require.NoError(t, json.Unmarshal(data, &metadata))
+	require.Equal(t, float64(5), metadata["version"])
+	require.Equal(t, "wallet-directories", metadata["layout"])
+	require.Equal(t, canary, metadata["encryption"].(map[string]any)["canary"])
+	require.Equal(t, "aes-256-gcm", metadata["encryption"].(map[string]any)["cipher"])
+	require.NotContains(t, metadata, "canary")
+}
+
+func TestOpenUnversioned(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	passphrase := []byte("test")
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+
+	// Rewrite the metadata as it was before the format recorded a version.
+	metadataPath := filepath.Join(path, "store.json")
+	data, err := os.ReadFile(metadataPath)
+	require.NoError(t, err)
+	metadata := make(map[string]any)
+	require.NoError(t, json.Unmarshal(data, &metadata))
+	canary := metadata["encryption"].(map[string]any)["canary"]
+	data, err = json.Marshal(map[string]any{"canary": canary})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(metadataPath, data, 0o600))
+
+	// The canary is still checked.
+	_, err = filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("wrong")))
+	require.True(t, errors.Is(err, filesystem.ErrIncorrectPassphrase))
+
+	opened, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(passphrase))
+	require.NoError(t, err)
+	_, err = opened.RetrieveWalletByID(walletID)
+	require.NoError(t, err)
+	data, err = os.ReadFile(metadataPath)
+	require.NoError(t, err)
+	metadata = make(map[string]any)
+	require.NoError(t, json.Unmarshal(data, &metadata))
+	require.Equal(t, float64(5), metadata["version"])
+	require.Equal(t, canary, metadata["encryption"].(map[string]any)["canary"])
+
+	// Metadata for an unencrypted store before the format recorded a version is empty.
+	unencryptedPath := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(unencryptedPath)
+	require.NoError(t, filesystem.New(filesystem.WithLocation(unencryptedPath)).StoreWallet(walletID, walletName, walletData))
+	require.NoError(t, os.WriteFile(filepath.Join(unencryptedPath, "store.json"), []byte(`{}`), 0o600))
+	_, err = filesystem.Open(filesystem.WithLocation(unencryptedPath))
+	require.NoError(t, err)
+}
+
+func TestNewerVersion(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path))
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	walletData := []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, walletName, walletData))
+
+	require.NoError(t, os.WriteFile(filepath.Join(path, "store.json"), []byte(`{"version":999}`), 0o600))
+
+	// Reads continue to work, but writes are refused.
+	_, err := store.RetrieveWalletByID(walletID)
+	require.NoError(t, err)
+	err = store.StoreWallet(walletID, walletName, walletData)
+	require.True(t, errors.Is(err, filesystem.ErrUnsupportedVersion))
+	err = store.StoreAccount(walletID, uuid.New(), []byte(`{"name":"test account"}`))
+	require.True(t, errors.Is(err, filesystem.ErrUnsupportedVersion))
+}
@@ -14,86 +14,228 @@
 package filesystem
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/wealdtech/go-indexer"
 )
 
 // StoreWallet stores wallet-level data.  It will fail if it cannot store the data.
 // Note that this will overwrite any existing data; it is up to higher-level functions to check for the presence of a wallet with
 // the wallet name and handle clashes accordingly.
-func (s *Store) StoreWallet(walletID uuid.UUID, _ string, data []byte) error {
+// If a passphrase is supplied for the wallet, the wallet is encrypted with it
+// in place of the store's passphrase from then on.
+// The wallet's name is recorded in the store's index of wallet names, taken
+// from the data if it holds one or from the name supplied otherwise.
+func (s *Store) StoreWallet(walletID uuid.UUID, walletName string, data []byte) error {
+	unlock, err := s.lockWallet(walletID, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
+	if err := s.ensureMetadata(); err != nil {
+		return errors.Wrap(err, "failed to create store metadata")
+	}
 	if err := s.ensureWalletPathExists(walletID); err != nil {
 		return errors.Wrap(err, "wallet path does not exist")
 	}
-	data, err := s.encryptIfRequired(data)
+	if err := s.ensureWalletPassphraseMarker(walletID); err != nil {
+		return err
+	}
+	if name := nameOf(data); name != "" {
+		walletName = name
+	}
+	data, err = s.encryptIfRequired(walletBinding(walletID), data)
 	if err != nil {
 		return errors.Wrap(err, "failed to encrypt wallet")
 	}
 
-	return os.WriteFile(s.walletHeaderPath(walletID), data, 0o600)
+	if err := writeFile(s.walletHeaderPath(walletID), data, 0o600); err != nil {
+		return err
+	}
+	if err := s.updateWalletNames(func(index *indexer.Index) {
+		s.setWalletName(index, walletID, walletName)
+	}); err != nil {
+		return errors.Wrap(err, "failed to update index of wallet names")
+	}
+
+	return nil
 }
 
-// RetrieveWallet retrieves wallet-level data.  It will fail if it cannot retrieve the data.
-func (s *Store) RetrieveWallet(walletName string) ([]byte, error) {
-	for data := range s.RetrieveWallets() {
-		info := &struct {
-			Name string `json:"name"`
-		}{}
-		err := json.Unmarshal(data, info)
-		if err == nil && info.Name == walletName {
-			return data, nil
+// WalletNameConflictError is returned when a wallet cannot be created because
+// another wallet has the same name.
+type WalletNameConflictError struct {
+	Name             string
+	ExistingWalletID uuid.UUID
+}
+
+// Error returns a description of the error.
+func (e *WalletNameConflictError) Error() string {
+	return fmt.Sprintf("wallet name %q is already used by wallet %s", e.Name, e.ExistingWalletID)
+}
+
+// Is allows the error to match ErrWalletNameConflict.
+func (e *WalletNameConflictError) Is(target error) bool {
+	return target == ErrWalletNameConflict
+}
+
+// CreateWallet stores wallet-level data for a new wallet.  Unlike StoreWallet it
+// will not overwrite an existing wallet: it returns ErrWalletExists if a wallet
+// with the same ID exists, and a WalletNameConflictError if a wallet with the same
+// name exists.  The check and the creation of the wallet's directory are carried
+// out under a lock, so if multiple processes create a wallet with the same name at
+// the same time only one of them succeeds.
+// It fails if any wallet cannot be read, as the name cannot then be checked,
+// other than wallets with their own passphrase that is not supplied, which are
+// not checked.
+func (s *Store) CreateWallet(walletID uuid.UUID, walletName string, data []byte) error {
+	unlock, err := s.lockWallet(walletID, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
+	if err := s.ensureMetadata(); err != nil {
+		return errors.Wrap(err, "failed to create store metadata")
+	}
+	if name := nameOf(data); name != "" {
+		walletName = name
+	}
+
+	lock, err := s.acquireLock(s.walletNamesLockPath(), true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock index of wallet names")
+	}
+	defer lock.unlock()
+
+	index := s.loadWalletNames()
+	existingID, _, err := s.findWalletInIndex(index, walletName, false)
+	switch {
+	case err == nil && existingID != walletID:
+		return &WalletNameConflictError{Name: walletName, ExistingWalletID: existingID}
+	case err != nil && !errors.Is(err, ErrWalletNotFound):
+		// Without reading every wallet the name cannot be known to be unique.
+		return errors.Wrap(err, "failed to check for a wallet with the same name")
+	}
+
+	if err := os.Mkdir(s.walletPath(walletID), 0o700); err != nil {
+		if os.IsExist(err) {
+			return errors.Wrap(ErrWalletExists, walletID.String())
 		}
+		return errors.Wrap(err, "failed to create wallet directory")
+	}
+	if err := s.createWallet(walletID, data); err != nil {
+		_ = removeDir(s.walletPath(walletID))
+		return err
+	}
+
+	s.setWalletName(index, walletID, walletName)
+	if err := s.saveWalletNames(index); err != nil {
+		return errors.Wrap(err, "failed to update index of wallet names")
+	}
+
+	return nil
+}
+
+// createWallet writes the header of a newly-created wallet.
+// The caller must hold an exclusive lock on the wallet.
+func (s *Store) createWallet(walletID uuid.UUID, data []byte) error {
+	if err := s.ensureWalletPassphraseMarker(walletID); err != nil {
+		return err
+	}
+	data, err := s.encryptIfRequired(walletBinding(walletID), data)
+	if err != nil {
+		return errors.Wrap(err, "failed to encrypt wallet")
 	}
 
-	return nil, errors.New("wallet not found")
+	return writeFile(s.walletHeaderPath(walletID), data, 0o600)
+}
+
+// RetrieveWallet retrieves wallet-level data.  It will fail if it cannot retrieve the data.
+func (s *Store) RetrieveWallet(walletName string) ([]byte, error) {
+	return s.findWalletByName(walletName)
 }
 
 // RetrieveWalletByID retrieves wallet-level data.  It will fail if it cannot retrieve the data.
 func (s *Store) RetrieveWalletByID(walletID uuid.UUID) ([]byte, error) {
-	for data := range s.RetrieveWallets() {
-		info := &struct {
-			ID uuid.UUID `json:"uuid"`
-		}{}
-		err := json.Unmarshal(data, info)
-		if err == nil && info.ID == walletID {
-			return data, nil
-		}
+	return s.retrieveWalletByIDWithLock(walletID, true)
+}
+
+// retrieveWalletByID retrieves wallet-level data without obtaining locks, for use
+// by functions that already hold them.
+func (s *Store) retrieveWalletByID(walletID uuid.UUID) ([]byte, error) {
+	return s.retrieveWalletByIDWithLock(walletID, false)
+}
+
+// retrieveWalletByIDWithLock retrieves wallet-level data, optionally obtaining
+// a shared lock on the wallet as it is read.
+func (s *Store) retrieveWalletByIDWithLock(walletID uuid.UUID, lock bool) ([]byte, error) {
+	res := s.retrieveWalletResult(walletID, lock)
+	if res == nil {
+		return nil, ErrWalletNotFound
+	}
+	if res.Err != nil {
+		return nil, res.Err
+	}
+
+	info := &struct {
+		ID uuid.UUID `json:"uuid"`
+	}{}
+	if err := json.Unmarshal(res.Data, info); err != nil || info.ID != walletID {
+		return nil, ErrWalletNotFound
 	}
 
-	return nil, errors.New("wallet not found")
+	return res.Data, nil
 }
 
 // RetrieveWallets retrieves wallet-level data for all wallets.
+// Wallets that cannot be retrieved are skipped; use RetrieveWalletResults to find out
+// about them.  The caller must read the channel until it is closed; use
+// RetrieveWalletsContext to be able to stop early.
 func (s *Store) RetrieveWallets() <-chan []byte {
 	ch := make(chan []byte, 1024)
 	go func() {
 		defer close(ch)
-		dirs, err := os.ReadDir(s.location)
-		if err != nil {
-			return
-		}
-		for _, dir := range dirs {
-			if !dir.IsDir() {
-				continue
-			}
-			walletID, err := uuid.Parse(dir.Name())
-			if err != nil {
-				continue
-			}
-			data, err := os.ReadFile(s.walletHeaderPath(walletID))
-			if err != nil {
-				continue
-			}
-			data, err = s.decryptIfRequired(data)
-			if err != nil {
-				continue
+		s.walkWallets(context.Background(), true, func(res *RetrieveResult) bool {
+			if res.Err == nil {
+				ch <- res.Data
 			}
-			ch <- data
-		}
+			return true
+		})
 	}()
 
 	return ch
 }
+
+// DeleteWallet deletes a wallet, along with all of its accounts, index and batch.
+// It will return ErrWalletNotFound if the wallet does not exist.
+func (s *Store) DeleteWallet(walletID uuid.UUID) error {
+	unlock, err := s.lockWallet(walletID, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock wallet")
+	}
+	defer unlock()
+
+	if _, err := os.Stat(s.walletHeaderPath(walletID)); err != nil {
+		if os.IsNotExist(err) {
+			return errors.Wrap(ErrWalletNotFound, walletID.String())
+		}
+		return errors.Wrap(err, "failed to obtain wallet information")
+	}
+
+	if err := removeDir(s.walletPath(walletID)); err != nil {
+		return errors.Wrap(err, "failed to remove wallet")
+	}
+	if err := s.updateWalletNames(func(index *indexer.Index) {
+		removeIndexEntry(index, walletID)
+	}); err != nil {
+		return errors.Wrap(err, "failed to update index of wallet names")
+	}
+
+	return nil
+}
@@ -14,6 +14,7 @@
 package filesystem_test
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -54,4 +55,37 @@ func TestRetrieveNonExistentWallet(t *testing.T) {
 
 	_, err := store.RetrieveWallet(walletName)
 	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
+
+	_, err = store.RetrieveWalletByID(uuid.New())
+	assert.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
+}
+
+func TestDeleteWallet(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path)).(*filesystem.Store)
+
+	walletID := uuid.New()
+	walletName := "test wallet"
+	data := []byte(fmt.Sprintf(`{"uuid":%q,"name":%q}`, walletID, walletName))
+	require.NoError(t, store.StoreWallet(walletID, walletName, data))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+
+	require.NoError(t, store.DeleteWallet(walletID))
+
+	_, err := store.RetrieveWalletByID(walletID)
+	require.Error(t, err)
+	_, err = os.Stat(filepath.Join(path, walletID.String()))
+	require.True(t, os.IsNotExist(err))
+	entries, err := os.ReadDir(path)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NotContains(t, entry.Name(), walletID.String())
+	}
+
+	err = store.DeleteWallet(walletID)
+	require.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
 }
@@ -0,0 +1,269 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/wealdtech/go-indexer"
+)
+
+// The store holds an index of the names of its wallets, so that a wallet can
+// be found by name without reading every wallet.  The index is maintained by
+// StoreWallet and DeleteWallet, and rebuilt if it is missing.  Entries are
+// checked against the wallet when used, and if the index does not lead to the
+// wallet every wallet is read to find it, rebuilding the index if it turns out
+// to be out of date.  Wallets with their own passphrase are not held in the
+// index, as it is encrypted with the store's passphrase.
+
+// nameOf returns the name held in a wallet's or account's data.
+func nameOf(data []byte) string {
+	info := &struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return ""
+	}
+
+	return info.Name
+}
+
+// readWalletNames reads the index of wallet names.
+// It returns nil without an error if there is no index.
+func (s *Store) readWalletNames() (*indexer.Index, error) {
+	data, err := os.ReadFile(s.walletNamesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := s.checkBound(data); err != nil {
+		return nil, err
+	}
+	encryptor := s.storeEncryptor()
+	data, encrypted, err := unsealData(encryptor, walletNamesBinding(), data)
+	if err != nil {
+		return nil, err
+	}
+	if encryptor != nil && !encrypted {
+		return nil, fmt.Errorf("%w: data is not encrypted", ErrDecryptionFailed)
+	}
+
+	return indexer.Deserialize(data)
+}
+
+// writeWalletNames writes the index of wallet names.  The caller must hold a
+// store-level lock and the lock on the index.
+func (s *Store) writeWalletNames(index *indexer.Index) error {
+	data, err := index.Serialize()
+	if err != nil {
+		return err
+	}
+	data, err = sealData(s.storeEncryptor(), walletNamesBinding(), data)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(s.walletNamesPath(), data, 0o600)
+}
+
+// scanWalletNames builds the index of wallet names by reading every wallet,
+// returning the index and the number of wallets in it.
+// Wallets are read without locks, so the caller may hold locks on wallets.
+func (s *Store) scanWalletNames() (*indexer.Index, int) {
+	index := indexer.New()
+	wallets := 0
+	s.walkWallets(context.Background(), false, func(res *RetrieveResult) bool {
+		if res.Err != nil {
+			return true
+		}
+		walletID, err := uuid.Parse(filepath.Base(res.Path))
+		if err != nil || s.hasWalletPassphrase(walletID) {
+			return true
+		}
+		index.Add(walletID, nameOf(res.Data))
+		wallets++
+		return true
+	})
+
+	return index, wallets
+}
+
+// rebuildWalletNames builds the index of wallet names, and writes it to the
+// store if it is missing or, if replace is set, out of date.  The index is
+// only written if it holds a wallet, as otherwise there is nothing to show
+// that the store's passphrase is correct.
+func (s *Store) rebuildWalletNames(replace bool) *indexer.Index {
+	if _, err := os.Stat(s.location); err != nil {
+		// Nothing to index.
+		return indexer.New()
+	}
+
+	unlockStore, err := s.lockStore(false)
+	if err != nil {
+		index, _ := s.scanWalletNames()
+		return index
+	}
+	defer unlockStore()
+	lock, err := s.acquireLock(s.walletNamesLockPath(), true)
+	if err != nil {
+		index, _ := s.scanWalletNames()
+		return index
+	}
+	defer lock.unlock()
+
+	if !replace {
+		if existing, err := s.readWalletNames(); err == nil && existing != nil {
+			// Written by another process in the meantime.
+			return existing
+		}
+	}
+	// Wallets are scanned with the index locked, so that updates to the index
+	// made while the wallets are read are not lost.
+	index, wallets := s.scanWalletNames()
+	if wallets > 0 && s.checkVersion() == nil {
+		_ = s.writeWalletNames(index)
+	}
+
+	return index
+}
+
+// updateWalletNames applies the update to the index of wallet names, building
+// the index first if it is missing.  If the index cannot be written it is
+// removed, so that it is rebuilt rather than being out of date.  The caller
+// must hold a store-level lock.
+func (s *Store) updateWalletNames(update func(index *indexer.Index)) error {
+	lock, err := s.acquireLock(s.walletNamesLockPath(), true)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	index := s.loadWalletNames()
+	update(index)
+
+	return s.saveWalletNames(index)
+}
+
+// loadWalletNames reads the index of wallet names, building it if it is
+// missing or cannot be read.  Wallets are read without locks, so the caller
+// may hold locks on wallets.
+func (s *Store) loadWalletNames() *indexer.Index {
+	index, err := s.readWalletNames()
+	if err != nil || index == nil {
+		index, _ = s.scanWalletNames()
+	}
+
+	return index
+}
+
+// saveWalletNames writes the index of wallet names, removing it if it cannot
+// be written.  The caller must hold a store-level lock and the lock on the
+// index.
+func (s *Store) saveWalletNames(index *indexer.Index) error {
+	if err := s.writeWalletNames(index); err != nil {
+		_ = os.Remove(s.walletNamesPath())
+		return err
+	}
+
+	return nil
+}
+
+// setWalletName records the name of the wallet in the index of wallet names,
+// or removes it from the index if the wallet has its own passphrase.
+// The caller must hold an exclusive lock on the wallet.
+func (s *Store) setWalletName(index *indexer.Index, walletID uuid.UUID, name string) {
+	removeIndexEntry(index, walletID)
+	if !s.hasWalletPassphrase(walletID) {
+		index.Add(walletID, name)
+	}
+}
+
+// findWalletByName finds a wallet by name, using the index of wallet names.
+func (s *Store) findWalletByName(walletName string) ([]byte, error) {
+	index, err := s.readWalletNames()
+	if err != nil || index == nil {
+		index = s.rebuildWalletNames(false)
+	}
+	walletID, data, err := s.findWalletInIndex(index, walletName, true)
+	if err != nil {
+		return nil, err
+	}
+	if indexedID, exists := index.ID(walletName); (!exists || indexedID != walletID) && !s.hasWalletPassphrase(walletID) {
+		// The wallet should have been found with the index.
+		s.rebuildWalletNames(true)
+	}
+
+	return data, nil
+}
+
+// findWalletInIndex finds a wallet by name, using the given index of wallet
+// names, returning its ID and data.  The entry in the index is checked against
+// the wallet, and if it does not lead to the wallet every wallet is read to
+// find it, as the index may be out of date or not hold the wallet.  If lock is
+// set a shared lock is obtained on each wallet as it is read.
+// ErrWalletNotFound is only returned if every wallet could be read, or is
+// locked with its own passphrase; otherwise the error from reading the wallet
+// is returned.
+func (s *Store) findWalletInIndex(index *indexer.Index, walletName string, lock bool) (uuid.UUID, []byte, error) {
+	if walletID, exists := index.ID(walletName); exists {
+		data, err := s.retrieveWalletByIDWithLock(walletID, lock)
+		if err == nil && nameOf(data) == walletName {
+			return walletID, data, nil
+		}
+	}
+
+	dirs, err := os.ReadDir(s.location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return uuid.Nil, nil, ErrWalletNotFound
+		}
+		return uuid.Nil, nil, errors.Wrapf(err, "failed to read store at %s", s.location)
+	}
+	var walletErr error
+	for _, dir := range dirs {
+		if !dir.IsDir() || isInternalFile(dir.Name()) {
+			continue
+		}
+		walletID, err := uuid.Parse(dir.Name())
+		if err != nil {
+			continue
+		}
+		res := s.retrieveWalletResult(walletID, lock)
+		switch {
+		case res == nil:
+			// Wallet removed since the store was read.
+		case res.Err == nil:
+			if nameOf(res.Data) == walletName {
+				return walletID, res.Data, nil
+			}
+		case errors.Is(res.Err, ErrWalletLocked), errors.Is(res.Err, ErrWalletNotFound):
+			// Not visible to this store.
+		case walletErr == nil:
+			walletErr = res.Err
+		}
+	}
+	if walletErr != nil {
+		return uuid.Nil, nil, walletErr
+	}
+
+	return uuid.Nil, nil, ErrWalletNotFound
+}
@@ -0,0 +1,144 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+func TestWalletNames(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("test"))).(*filesystem.Store)
+	namesPath := filepath.Join(path, "wallets.json")
+
+	walletIDs := make([]uuid.UUID, 3)
+	for i := range walletIDs {
+		walletIDs[i] = uuid.New()
+		walletName := fmt.Sprintf("wallet %d", i)
+		require.NoError(t, store.StoreWallet(walletIDs[i], walletName, []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletName, walletIDs[i]))))
+	}
+	_, err := os.Stat(namesPath)
+	require.NoError(t, err)
+	staleNames, err := os.ReadFile(namesPath)
+	require.NoError(t, err)
+
+	data, err := store.RetrieveWallet("wallet 1")
+	require.NoError(t, err)
+	require.Contains(t, string(data), walletIDs[1].String())
+	_, err = store.RetrieveWallet("unknown")
+	require.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
+	_, err = store.RetrieveWalletByID(uuid.New())
+	require.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
+
+	// Renamed wallet.
+	require.NoError(t, store.StoreWallet(walletIDs[1], "renamed", []byte(fmt.Sprintf(`{"name":"renamed","uuid":%q}`, walletIDs[1]))))
+	_, err = store.RetrieveWallet("wallet 1")
+	require.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
+	data, err = store.RetrieveWallet("renamed")
+	require.NoError(t, err)
+	require.Contains(t, string(data), walletIDs[1].String())
+
+	// Deleted wallet.
+	require.NoError(t, store.DeleteWallet(walletIDs[2]))
+	_, err = store.RetrieveWallet("wallet 2")
+	require.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
+
+	// An out-of-date index is checked against the wallets.
+	require.NoError(t, os.WriteFile(namesPath, staleNames, 0o600))
+	_, err = store.RetrieveWallet("wallet 1")
+	require.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
+	_, err = store.RetrieveWallet("wallet 2")
+	require.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
+	// The wallet is found under its current name, and the index is rebuilt.
+	data, err = store.RetrieveWallet("renamed")
+	require.NoError(t, err)
+	require.Contains(t, string(data), walletIDs[1].String())
+	names, err := os.ReadFile(namesPath)
+	require.NoError(t, err)
+	require.NotEqual(t, staleNames, names)
+
+	// A missing index is rebuilt.
+	require.NoError(t, os.Remove(namesPath))
+	data, err = store.RetrieveWallet("renamed")
+	require.NoError(t, err)
+	require.Contains(t, string(data), walletIDs[1].String())
+	_, err = os.Stat(namesPath)
+	require.NoError(t, err)
+	data, err = store.RetrieveWallet("wallet 0")
+	require.NoError(t, err)
+	require.Contains(t, string(data), walletIDs[0].String())
+
+	// As is an index that cannot be read.
+	require.NoError(t, os.WriteFile(namesPath, []byte("bad"), 0o600))
+	data, err = store.RetrieveWallet("wallet 0")
+	require.NoError(t, err)
+	require.Contains(t, string(data), walletIDs[0].String())
+}
+
+func TestWalletNamesWalletPassphrase(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+
+	walletID := uuid.New()
+	walletPassphrases := map[uuid.UUID][]byte{walletID: []byte("wallet")}
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithWalletPassphrases(walletPassphrases))
+	require.NoError(t, store.StoreWallet(walletID, "private wallet", []byte(fmt.Sprintf(`{"name":"private wallet","uuid":%q}`, walletID))))
+	otherWalletID := uuid.New()
+	require.NoError(t, store.StoreWallet(otherWalletID, "public wallet", []byte(fmt.Sprintf(`{"name":"public wallet","uuid":%q}`, otherWalletID))))
+
+	// The name of the wallet with its own passphrase is not in the index.
+	names, err := os.ReadFile(filepath.Join(path, "wallets.json"))
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(names, []byte("private wallet")))
+	require.True(t, bytes.Contains(names, []byte("public wallet")))
+
+	// But the wallet can still be found by name with its passphrase.
+	data, err := store.RetrieveWallet("private wallet")
+	require.NoError(t, err)
+	require.Contains(t, string(data), walletID.String())
+	_, err = filesystem.New(filesystem.WithLocation(path)).RetrieveWallet("private wallet")
+	require.True(t, errors.Is(err, filesystem.ErrWalletNotFound))
+}
+
+func TestRetrieveWalletWrongPassphrase(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("test")))
+
+	walletID := uuid.New()
+	require.NoError(t, store.StoreWallet(walletID, "test wallet", []byte(fmt.Sprintf(`{"name":"test wallet","uuid":%q}`, walletID))))
+
+	// A wrong passphrase is reported as such, rather than as a missing wallet.
+	wrongStore := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase([]byte("wrong")))
+	_, err := wrongStore.RetrieveWalletByID(walletID)
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+	require.False(t, errors.Is(err, filesystem.ErrWalletNotFound))
+	_, err = wrongStore.RetrieveWallet("test wallet")
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+	require.False(t, errors.Is(err, filesystem.ErrWalletNotFound))
+	err = wrongStore.StoreAccount(walletID, uuid.New(), []byte(`{"name":"test account"}`))
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+	require.False(t, errors.Is(err, filesystem.ErrWalletNotFound))
+}
@@ -0,0 +1,238 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// WithWalletPassphrases sets passphrases for individual wallets, which are
+// used to encrypt the wallets' data in place of the store's passphrase.
+func WithWalletPassphrases(passphrases map[uuid.UUID][]byte) Option {
+	return WithWalletPassphraseFunc(func(walletID uuid.UUID) ([]byte, error) {
+		return passphrases[walletID], nil
+	})
+}
+
+// WithWalletPassphraseFunc sets a function that supplies passphrases for
+// individual wallets, which are used to encrypt the wallets' data in place of
+// the store's passphrase.  The function returns nil for a wallet that does
+// not have its own passphrase, or whose passphrase is not known.
+// A wallet is encrypted with its own passphrase once it is stored with the
+// passphrase supplied, which re-encrypts any data the wallet already holds.
+func WithWalletPassphraseFunc(fn func(walletID uuid.UUID) ([]byte, error)) Option {
+	return optionFunc(func(o *options) {
+		o.walletPassphrase = fn
+	})
+}
+
+// walletEncryptor returns the encryptor for the wallet's own passphrase, or
+// nil if the passphrase for the wallet is not supplied.
+func (s *Store) walletEncryptor(walletID uuid.UUID) (Encryptor, error) {
+	if s.walletPassphrase == nil {
+		return nil, nil
+	}
+	passphrase, err := s.walletPassphrase(walletID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain passphrase for wallet %s: %w", walletID, err)
+	}
+	if len(passphrase) == 0 {
+		return nil, nil
+	}
+
+	s.keysMutex.Lock()
+	defer s.keysMutex.Unlock()
+	if s.walletKeys == nil {
+		s.walletKeys = make(map[uuid.UUID]*keyCache)
+	}
+	keys, exists := s.walletKeys[walletID]
+	if !exists || !bytes.Equal(keys.passphrase, passphrase) {
+		if exists {
+			keys.retire()
+		}
+		keys = newKeyCache(passphrase, s.kdf)
+		s.walletKeys[walletID] = keys
+	}
+
+	return &passphraseEncryptor{keys: keys}, nil
+}
+
+// hasWalletPassphrase returns true if the wallet is encrypted with its own passphrase.
+func (s *Store) hasWalletPassphrase(walletID uuid.UUID) bool {
+	_, err := os.Stat(s.walletPassphraseMarkerPath(walletID))
+
+	return err == nil
+}
+
+// encryptorFor returns the encryptor for data in the given wallet.  This is
+// the wallet's own encryptor if the wallet is marked as having its own
+// passphrase, otherwise the store's encryptor.
+// Data in a wallet with its own passphrase cannot be written without it.
+func (s *Store) encryptorFor(walletID uuid.UUID) (Encryptor, error) {
+	if !s.hasWalletPassphrase(walletID) {
+		return s.storeEncryptor(), nil
+	}
+	encryptor, err := s.walletEncryptor(walletID)
+	if err != nil {
+		return nil, err
+	}
+	if encryptor == nil {
+		return nil, fmt.Errorf("%w: %s", ErrWalletLocked, walletID)
+	}
+
+	return encryptor, nil
+}
+
+// decryptorFor returns the encryptor with which to decrypt data in the given
+// wallet.  This is the wallet's own encryptor if the wallet is marked as
+// having its own passphrase, which is nil if the passphrase is not supplied,
+// otherwise the store's encryptor.
+func (s *Store) decryptorFor(walletID uuid.UUID) (Encryptor, error) {
+	if !s.hasWalletPassphrase(walletID) {
+		return s.storeEncryptor(), nil
+	}
+
+	return s.walletEncryptor(walletID)
+}
+
+// ensureWalletPassphraseMarker marks the wallet as encrypted with its own
+// passphrase if one is supplied.  If the wallet is already marked the
+// passphrase is checked against the wallet's header, so that data is not
+// written with a different passphrase to that of the existing data.  If the
+// wallet is not marked but already holds data, the data is re-encrypted with
+// the wallet's passphrase and committed along with the marker.
+// The caller must hold an exclusive lock on the wallet.
+func (s *Store) ensureWalletPassphraseMarker(walletID uuid.UUID) error {
+	encryptor, err := s.walletEncryptor(walletID)
+	if err != nil || encryptor == nil {
+		return err
+	}
+	if s.hasWalletPassphrase(walletID) {
+		return s.checkWalletPassphrase(walletID, encryptor)
+	}
+
+	changes, err := s.walletPassphraseChanges(walletID, encryptor)
+	if err != nil {
+		return fmt.Errorf("failed to re-encrypt wallet with its own passphrase: %w", err)
+	}
+	changes = append(changes, &walletChange{path: s.walletPassphraseMarkerPath(walletID), data: []byte{}})
+	if err := s.commitWalletChanges(walletID, changes); err != nil {
+		return fmt.Errorf("failed to mark wallet as having its own passphrase: %w", err)
+	}
+
+	return nil
+}
+
+// checkWalletPassphrase checks that the wallet's passphrase decrypts the
+// wallet's header, if it has one.
+func (s *Store) checkWalletPassphrase(walletID uuid.UUID, encryptor Encryptor) error {
+	data, err := os.ReadFile(s.walletHeaderPath(walletID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read wallet: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	plaintext, err := plaintextOf(encryptor, walletBinding(walletID), data)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrWalletLocked, err)
+	}
+	zero(plaintext)
+
+	return nil
+}
+
+// walletPassphraseChanges returns the changes that re-encrypt the data in a
+// wallet from the store's encryptor to the wallet's encryptor.  All of the
+// data is decrypted before any changes are made, so data that cannot be
+// decrypted with the store's encryptor leaves the wallet unchanged.
+func (s *Store) walletPassphraseChanges(walletID uuid.UUID, encryptor Encryptor) ([]*walletChange, error) {
+	entries, err := os.ReadDir(s.walletPath(walletID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read wallet directory: %w", err)
+	}
+	files, err := s.walletDataFiles(walletID, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	storeEncryptor := s.storeEncryptor()
+	changes := make([]*walletChange, 0, len(files)+1)
+	for _, file := range files {
+		data, err := os.ReadFile(file.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.path, err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		if err := s.checkBound(data); err != nil {
+			return nil, err
+		}
+		legacyEmptyIndex := file.index && !isEnvelope(data) && len(data) == 2
+		if storeEncryptor != nil && !isEncrypted(data) && !legacyEmptyIndex {
+			return nil, fmt.Errorf("%w: %s is not encrypted", ErrDecryptionFailed, file.path)
+		}
+		plaintext, err := plaintextOf(storeEncryptor, file.binding, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", file.path, err)
+		}
+		data, err = sealData(encryptor, file.binding, plaintext)
+		zero(plaintext)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, &walletChange{path: file.path, data: data})
+	}
+
+	return changes, nil
+}
+
+// LockedWallets returns the IDs of the wallets that are encrypted with their
+// own passphrase, for which the passphrase has not been supplied or is
+// incorrect.  These wallets are not returned by RetrieveWallets.
+func (s *Store) LockedWallets() ([]uuid.UUID, error) {
+	walletIDs := make([]uuid.UUID, 0)
+	var err error
+	s.walkWallets(context.Background(), true, func(res *RetrieveResult) bool {
+		switch {
+		case res.Path == s.location:
+			err = res.Err
+		case errors.Is(res.Err, ErrWalletLocked):
+			walletID, parseErr := uuid.Parse(filepath.Base(res.Path))
+			if parseErr == nil {
+				walletIDs = append(walletIDs, walletID)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return walletIDs, nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2026 Weald Technology Trading.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	filesystem "github.com/wealdtech/go-eth2-wallet-store-filesystem"
+)
+
+func TestWalletPassphrases(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	storePassphrase := []byte("store")
+
+	teamAWalletID := uuid.New()
+	teamBWalletID := uuid.New()
+	sharedWalletID := uuid.New()
+	teamAPassphrase := []byte("team a")
+	teamBPassphrase := []byte("team b")
+
+	// Each team stores its own wallet.
+	walletData := make(map[uuid.UUID][]byte)
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	for walletID, passphrases := range map[uuid.UUID]map[uuid.UUID][]byte{
+		teamAWalletID:  {teamAWalletID: teamAPassphrase},
+		teamBWalletID:  {teamBWalletID: teamBPassphrase},
+		sharedWalletID: {},
+	} {
+		store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(storePassphrase), filesystem.WithWalletPassphrases(passphrases)).(*filesystem.Store)
+		walletData[walletID] = []byte(fmt.Sprintf(`{"name":%q,"uuid":%q}`, walletID.String(), walletID.String()))
+		require.NoError(t, store.StoreWallet(walletID, walletID.String(), walletData[walletID]))
+		require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+		require.NoError(t, store.StoreAccountsIndex(walletID, []byte("[]")))
+		require.NoError(t, store.StoreBatch(ctx, walletID, walletID.String(), []byte(`{"test":true}`)))
+	}
+
+	// Team A sees its own wallet and the shared wallet, with team B's wallet locked.
+	store, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(storePassphrase), filesystem.WithWalletPassphraseFunc(func(walletID uuid.UUID) ([]byte, error) {
+		if walletID == teamAWalletID {
+			return teamAPassphrase, nil
+		}
+		return nil, nil
+	}))
+	require.NoError(t, err)
+	wallets := make(map[string]bool)
+	for data := range store.RetrieveWallets() {
+		wallets[string(data)] = true
+	}
+	require.Equal(t, map[string]bool{string(walletData[teamAWalletID]): true, string(walletData[sharedWalletID]): true}, wallets)
+	locked, err := store.LockedWallets()
+	require.NoError(t, err)
+	require.Equal(t, []uuid.UUID{teamBWalletID}, locked)
+
+	data, err := store.RetrieveAccount(teamAWalletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, data)
+	_, err = store.RetrieveAccount(teamBWalletID, accountID)
+	require.True(t, errors.Is(err, filesystem.ErrWalletLocked))
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+	_, err = store.RetrieveAccountsIndex(teamBWalletID)
+	require.True(t, errors.Is(err, filesystem.ErrWalletLocked))
+	_, err = store.RetrieveBatch(ctx, teamBWalletID)
+	require.True(t, errors.Is(err, filesystem.ErrWalletLocked))
+
+	// Team B's wallet cannot be overwritten without its passphrase.
+	err = store.StoreWallet(teamBWalletID, teamBWalletID.String(), walletData[teamBWalletID])
+	require.True(t, errors.Is(err, filesystem.ErrWalletLocked))
+
+	// Changing the store's passphrase leaves wallets with their own passphrase alone.
+	newStorePassphrase := []byte("new store")
+	require.NoError(t, store.ChangePassphrase(storePassphrase, newStorePassphrase))
+	teamBStore, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(newStorePassphrase), filesystem.WithWalletPassphrases(map[uuid.UUID][]byte{teamBWalletID: teamBPassphrase}))
+	require.NoError(t, err)
+	data, err = teamBStore.RetrieveAccount(teamBWalletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, data)
+	data, err = teamBStore.RetrieveWalletByID(sharedWalletID)
+	require.NoError(t, err)
+	require.Equal(t, walletData[sharedWalletID], data)
+}
+
+func TestWalletPassphraseUpgrade(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	storePassphrase := []byte("store")
+	walletPassphrase := []byte("wallet")
+
+	// The wallet is created with the store's passphrase.
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(storePassphrase)).(*filesystem.Store)
+	walletID := uuid.New()
+	walletData := []byte(fmt.Sprintf(`{"name":"test wallet","uuid":%q}`, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, "test wallet", walletData))
+	accountID := uuid.New()
+	accountData := []byte(fmt.Sprintf(`{"name":"test account","uuid":%q}`, accountID.String()))
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+	require.NoError(t, store.StoreAccountsIndex(walletID, []byte("[]")))
+
+	// Supplying a passphrase for the wallet does not change how it is read.
+	walletStore, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(storePassphrase), filesystem.WithWalletPassphrases(map[uuid.UUID][]byte{walletID: walletPassphrase}))
+	require.NoError(t, err)
+	data, err := walletStore.RetrieveWalletByID(walletID)
+	require.NoError(t, err)
+	require.Equal(t, walletData, data)
+	data, err = walletStore.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, data)
+
+	// Storing the wallet re-encrypts all of its data with the wallet's passphrase.
+	require.NoError(t, walletStore.StoreWallet(walletID, "test wallet", walletData))
+	_, err = os.Stat(filepath.Join(path, walletID.String(), ".passphrase"))
+	require.NoError(t, err)
+	data, err = walletStore.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	require.Equal(t, accountData, data)
+	data, err = walletStore.RetrieveAccountsIndex(walletID)
+	require.NoError(t, err)
+	require.Equal(t, []byte("[]"), data)
+	_, err = store.RetrieveAccount(walletID, accountID)
+	require.True(t, errors.Is(err, filesystem.ErrWalletLocked))
+
+	// The wallet cannot be written with a different passphrase.
+	wrongStore, err := filesystem.Open(filesystem.WithLocation(path), filesystem.WithPassphrase(storePassphrase), filesystem.WithWalletPassphrases(map[uuid.UUID][]byte{walletID: []byte("wrong")}))
+	require.NoError(t, err)
+	err = wrongStore.StoreWallet(walletID, "test wallet", walletData)
+	require.True(t, errors.Is(err, filesystem.ErrWalletLocked))
+	data, err = walletStore.RetrieveWalletByID(walletID)
+	require.NoError(t, err)
+	require.Equal(t, walletData, data)
+}
+
+func TestWalletPassphraseUpgradeUnreadable(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", t.Name(), rand.Int31()))
+	defer os.RemoveAll(path)
+	storePassphrase := []byte("store")
+
+	store := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(storePassphrase)).(*filesystem.Store)
+	walletID := uuid.New()
+	walletData := []byte(fmt.Sprintf(`{"name":"test wallet","uuid":%q}`, walletID.String()))
+	require.NoError(t, store.StoreWallet(walletID, "test wallet", walletData))
+	require.NoError(t, os.WriteFile(filepath.Join(path, walletID.String(), uuid.New().String()), []byte("unreadable"), 0o600))
+
+	// Data that cannot be decrypted leaves the wallet with the store's passphrase.
+	walletStore := filesystem.New(filesystem.WithLocation(path), filesystem.WithPassphrase(storePassphrase), filesystem.WithWalletPassphrases(map[uuid.UUID][]byte{walletID: []byte("wallet")})).(*filesystem.Store)
+	err := walletStore.StoreWallet(walletID, "test wallet", walletData)
+	require.True(t, errors.Is(err, filesystem.ErrDecryptionFailed))
+	_, err = os.Stat(filepath.Join(path, walletID.String(), ".passphrase"))
+	require.True(t, os.IsNotExist(err))
+	data, err := store.RetrieveWalletByID(walletID)
+	require.NoError(t, err)
+	require.Equal(t, walletData, data)
+}